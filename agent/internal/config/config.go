@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"log"
+
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
 )
 
 type Config struct {
@@ -16,6 +18,12 @@ type Config struct {
 	APIEndpoint             string `json:"api_endpoint"`
 	DisableDownloadLockfile bool   `json:"disable_download_lockfile"`
 
+	// How many hashcat processes we're happy to run at once, defaults to 1
+	MaxConcurrentJobs int `json:"max_concurrent_jobs"`
+
+	// Keeps jobs from cooking the hardware, the server can override any of it
+	ThermalPolicy wstypes.ThermalPolicyDTO `json:"thermal_policy"`
+
 	DisableTLSVerification bool `json:"disable_tls_verification"`
 }
 
@@ -43,5 +51,17 @@ func LoadConfig(configPath string) (config Config) {
 		config.AuthKey = strings.TrimSpace(string(authKeyBytes))
 	}
 
+	if config.MaxConcurrentJobs <= 0 {
+		config.MaxConcurrentJobs = 1
+	}
+
+	switch config.ThermalPolicy.Action {
+	case "":
+		config.ThermalPolicy.Action = wstypes.ThermalActionPause
+	case wstypes.ThermalActionPause, wstypes.ThermalActionKill:
+	default:
+		log.Fatalf("unknown thermal_policy action %q, expected %q or %q", config.ThermalPolicy.Action, wstypes.ThermalActionPause, wstypes.ThermalActionKill)
+	}
+
 	return
 }
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"log"
+
+	"github.com/lachlan2k/phatcrack/agent/internal/hashcat"
+	"github.com/lachlan2k/phatcrack/agent/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+)
+
+func (h *Handler) handleBenchmarkRequest(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.BenchmarkRequestDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to benchmark request dto: %v", msg.Payload, err)
+	}
+
+	return h.runBenchmark(payload)
+}
+
+func (h *Handler) runBenchmark(req wstypes.BenchmarkRequestDTO) error {
+	// Benchmarks would just fight each other over the devices, so run them one at a time
+	h.benchmarkLock.Lock()
+	defer h.benchmarkLock.Unlock()
+
+	result := wstypes.BenchmarkResultDTO{
+		HashType: req.HashType,
+	}
+
+	h.jobsLock.Lock()
+	numActiveJobs := len(h.activeJobs)
+	h.jobsLock.Unlock()
+
+	if numActiveJobs > 0 {
+		// Sharing the devices with a job would give us a number that's no use to anyone
+		result.Error = "agent was busy running jobs"
+	} else {
+		log.Printf("Benchmarking hash type %d", req.HashType)
+
+		devices, err := hashcat.RunBenchmark(h.conf, req.HashType)
+		if err != nil {
+			log.Printf("Benchmark of hash type %d failed: %v", req.HashType, err)
+			result.Error = err.Error()
+		}
+		result.Devices = devices
+	}
+
+	result.Time = time.Now()
+	return h.sendMessage(wstypes.BenchmarkResultType, result)
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/agent/internal/hashcat"
+	"github.com/lachlan2k/phatcrack/agent/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+)
+
+const checkpointFilename = "checkpoint.json"
+
+// What we need to pick a job back up if the agent is restarted while it's running
+// It lives in the job's session directory, alongside hashcat's restore file and outfile
+type jobCheckpoint struct {
+	Job         wstypes.JobStartDTO `json:"job"`
+	SessionName string              `json:"session_name"`
+	RestoreFile string              `json:"restore_file"`
+	OutFile     string              `json:"out_file"`
+	// How much of the outfile we've already sent to the server
+	OutfileOffset int64     `json:"outfile_offset"`
+	RestorePoint  int64     `json:"restore_point"`
+	Time          time.Time `json:"time"`
+}
+
+// Somewhere to keep things that need to outlive the agent, next to the listfiles if we have somewhere for those
+func (h *Handler) stateDirectory(name string) string {
+	dir := h.conf.ListfileDirectory
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	// Hashcat is run from its own directory, so everything we give it has to be absolute
+	dir, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		log.Printf("WARN: couldn't make %s directory absolute: %v", name, err)
+	}
+	return dir
+}
+
+func (h *Handler) checkpointsDirectory() string {
+	return h.stateDirectory("checkpoints")
+}
+
+func (h *Handler) jobDirectory(jobId string) string {
+	return filepath.Join(h.checkpointsDirectory(), jobId)
+}
+
+// Written to a temp file and moved into place, so we never leave a half-written checkpoint behind if we die
+func saveCheckpoint(dir string, checkpoint jobCheckpoint) error {
+	checkpoint.Time = time.Now()
+
+	checkpointJSON, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tempPath := filepath.Join(dir, checkpointFilename+".tmp")
+	err = os.WriteFile(tempPath, checkpointJSON, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, filepath.Join(dir, checkpointFilename))
+}
+
+func readCheckpoint(dir string) (jobCheckpoint, error) {
+	checkpointJSON, err := os.ReadFile(filepath.Join(dir, checkpointFilename))
+	if err != nil {
+		return jobCheckpoint{}, err
+	}
+
+	checkpoint, err := util.UnmarshalJSON[jobCheckpoint](string(checkpointJSON))
+	if err != nil {
+		return jobCheckpoint{}, err
+	}
+
+	if checkpoint.Job.ID != filepath.Base(dir) {
+		return jobCheckpoint{}, fmt.Errorf("checkpoint is for job %q, but is in the directory of %q", checkpoint.Job.ID, filepath.Base(dir))
+	}
+	return checkpoint, nil
+}
+
+// Finds the checkpoints of jobs that were running when we were last stopped, so the server can decide whether we should pick them back up
+// Anything that can't be used is cleaned up
+func (h *Handler) loadCheckpoints() {
+	h.jobsLock.Lock()
+	defer h.jobsLock.Unlock()
+
+	dir := h.checkpointsDirectory()
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("WARN: couldn't read checkpoints directory %q: %v", dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		jobDir := filepath.Join(dir, entry.Name())
+
+		checkpoint, err := readCheckpoint(jobDir)
+		if err != nil {
+			log.Printf("Discarding unusable checkpoint %q: %v", jobDir, err)
+			os.RemoveAll(jobDir)
+			continue
+		}
+
+		log.Printf("Found checkpoint for job %q, from %s", checkpoint.Job.ID, checkpoint.Time)
+		h.recoverableJobs[checkpoint.Job.ID] = checkpoint
+	}
+}
+
+func (h *Handler) getRecoverableJobs() []wstypes.RecoverableJobDTO {
+	h.jobsLock.Lock()
+	defer h.jobsLock.Unlock()
+
+	jobs := []wstypes.RecoverableJobDTO{}
+	for _, checkpoint := range h.recoverableJobs {
+		jobs = append(jobs, wstypes.RecoverableJobDTO{
+			JobID:        checkpoint.Job.ID,
+			RestorePoint: checkpoint.RestorePoint,
+			Time:         checkpoint.Time,
+		})
+	}
+	return jobs
+}
+
+func (h *Handler) handleJobResume(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.JobResumeDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to job resume dto: %v", msg.Payload, err)
+	}
+
+	return h.resumeJob(payload.JobID)
+}
+
+func (h *Handler) resumeJob(jobId string) error {
+	h.jobsLock.Lock()
+	defer h.jobsLock.Unlock()
+
+	checkpoint, ok := h.recoverableJobs[jobId]
+	if !ok {
+		return fmt.Errorf("no checkpoint for job %q", jobId)
+	}
+	delete(h.recoverableJobs, jobId)
+
+	dir := h.jobDirectory(jobId)
+	sess, err := hashcat.RestoreHashcatSession(dir, checkpoint.SessionName, checkpoint.RestoreFile, checkpoint.OutFile, checkpoint.OutfileOffset, h.conf)
+	if err != nil {
+		// Hashcat hadn't got far enough to write its restore file, so there's not much lost by starting again
+		log.Printf("Couldn't restore job %q, starting it again instead: %v", jobId, err)
+		os.RemoveAll(dir)
+		return h.runJobUnsafe(checkpoint.Job)
+	}
+
+	log.Printf("Resuming job %q from its checkpoint", jobId)
+	return h.startSessionUnsafe(checkpoint.Job, sess, checkpoint)
+}
+
+// The server would rather we didn't pick the job back up, e.g. because it has already been given to someone else
+func (h *Handler) discardCheckpointUnsafe(jobId string) bool {
+	_, ok := h.recoverableJobs[jobId]
+	if !ok {
+		return false
+	}
+	delete(h.recoverableJobs, jobId)
+
+	log.Printf("Discarding checkpoint for job %q", jobId)
+	os.RemoveAll(h.jobDirectory(jobId))
+	return true
+}
+
+// Job IDs end up in paths, so make sure they're what we expect
+func isValidJobID(jobId string) bool {
+	_, err := uuid.Parse(jobId)
+	return err == nil
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"log"
+
+	"github.com/lachlan2k/phatcrack/agent/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+)
+
+const crackSpoolEntryExt = ".json"
+
+// Batches of cracked hashes we've sent to the server, but haven't been told it has stored yet
+// Each one is written to disk before it's sent, and only removed once the server acknowledges it,
+// so they aren't lost if the connection drops, or we're restarted, in the middle of a burst of cracks
+type crackSpool struct {
+	lock    sync.Mutex
+	dir     string
+	lastSeq uint64
+}
+
+func newCrackSpool(dir string) *crackSpool {
+	spool := &crackSpool{
+		dir: dir,
+	}
+
+	err := spool.load()
+	if err != nil {
+		log.Printf("WARN: couldn't read cracked hash spool %q: %v", dir, err)
+	}
+	return spool
+}
+
+// Entries are named after their sequence number, padded so they sort in the order they were cracked
+func (s *crackSpool) entryPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, crackSpoolEntryExt))
+}
+
+func seqFromEntryName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, crackSpoolEntryExt) {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, crackSpoolEntryExt), 10, 64)
+	if err != nil || seq == 0 {
+		return 0, false
+	}
+	return seq, true
+}
+
+// Carries on numbering from whatever's left over from last time, so nothing still waiting has its number reused
+func (s *crackSpool) load() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		seq, ok := seqFromEntryName(entry.Name())
+		if !ok {
+			// e.g. a temp file from when we died half way through writing it
+			os.Remove(filepath.Join(s.dir, entry.Name()))
+			continue
+		}
+
+		s.lastSeq = max(s.lastSeq, seq)
+	}
+	return nil
+}
+
+// Numbers the batch and writes it to disk, returning it ready to send
+func (s *crackSpool) add(msg wstypes.JobCrackedHashBatchDTO) (wstypes.JobCrackedHashBatchDTO, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return msg, err
+	}
+
+	s.lastSeq++
+	msg.Seq = s.lastSeq
+
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		return msg, err
+	}
+
+	// Written to a temp file and moved into place, so we never replay half of one
+	path := s.entryPath(msg.Seq)
+	err = os.WriteFile(path+".tmp", msgJSON, 0600)
+	if err != nil {
+		return msg, err
+	}
+
+	return msg, os.Rename(path+".tmp", path)
+}
+
+func (s *crackSpool) remove(seq uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := os.Remove(s.entryPath(seq))
+	if errors.Is(err, os.ErrNotExist) {
+		// We've already been told, e.g. because we sent it again after reconnecting
+		return nil
+	}
+	return err
+}
+
+// Everything the server hasn't acknowledged yet, oldest first
+func (s *crackSpool) pending() ([]wstypes.JobCrackedHashBatchDTO, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := []wstypes.JobCrackedHashBatchDTO{}
+	for _, entry := range entries {
+		seq, ok := seqFromEntryName(entry.Name())
+		if !ok {
+			continue
+		}
+
+		msg, err := readCrackSpoolEntry(s.entryPath(seq))
+		if err != nil || msg.Seq != seq {
+			log.Printf("Discarding unusable cracked hash spool entry %q: %v", entry.Name(), err)
+			os.Remove(s.entryPath(seq))
+			continue
+		}
+
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func readCrackSpoolEntry(path string) (wstypes.JobCrackedHashBatchDTO, error) {
+	msgJSON, err := os.ReadFile(path)
+	if err != nil {
+		return wstypes.JobCrackedHashBatchDTO{}, err
+	}
+
+	batch, err := util.UnmarshalJSON[wstypes.JobCrackedHashBatchDTO](string(msgJSON))
+	if err != nil {
+		return batch, err
+	}
+	if len(batch.Results) == 0 {
+		return batch, errors.New("no cracked hashes in spool entry")
+	}
+	return batch, nil
+}
+
+func (h *Handler) handleJobCrackedHashAck(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.JobCrackedHashAckDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to job cracked hash ack dto: %v", msg.Payload, err)
+	}
+
+	return h.crackSpool.remove(payload.Seq)
+}
+
+// Sends everything the server hasn't acknowledged, which it might have already got before the connection dropped
+// That's fine, as storing a cracked hash twice does no harm
+func (h *Handler) resendSpooledCrackedHashes() {
+	msgs, err := h.crackSpool.pending()
+	if err != nil {
+		log.Printf("WARN: couldn't read cracked hash spool: %v", err)
+		return
+	}
+
+	if len(msgs) > 0 {
+		log.Printf("Sending %d batches of cracked hashes the server hasn't acknowledged yet", len(msgs))
+	}
+
+	for _, msg := range msgs {
+		err := h.sendMessage(wstypes.JobCrackedHashBatchType, msg)
+		if err != nil {
+			log.Printf("WARN: couldn't resend cracked hashes for job %q: %v", msg.JobID, err)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 type ActiveJob struct {
 	job        wstypes.JobStartDTO
 	stopReason string
+	paused     bool
 	sess       *hashcat.HashcatSession
 }
 
@@ -31,9 +32,17 @@ type Handler struct {
 	conf              *config.Config
 	jobsLock          sync.Mutex
 	fileDownloadLock  sync.Mutex
+	benchmarkLock     sync.Mutex
+	thermalLock       sync.Mutex
+	thermalOverride   wstypes.ThermalPolicyDTO
+	capabilitiesOnce  sync.Once
+	capabilities      wstypes.AgentHelloDTO
 	isDownloadingFile bool
 	activeJobs        map[string]*ActiveJob
-	downloadLockfile  Lockfile
+	// Jobs we were running before we were restarted, waiting for the server to tell us whether to resume them
+	recoverableJobs  map[string]jobCheckpoint
+	crackSpool       *crackSpool
+	downloadLockfile Lockfile
 }
 
 func (h *Handler) sendMessage(msgType string, payload interface{}) error {
@@ -69,12 +78,27 @@ func (h *Handler) handleMessage(msg *wstypes.Message) error {
 	case wstypes.JobKillType:
 		return h.handleJobKill(msg)
 
+	case wstypes.JobPauseType:
+		return h.handleJobPause(msg)
+
+	case wstypes.JobResumeType:
+		return h.handleJobResume(msg)
+
+	case wstypes.JobCrackedHashAckType:
+		return h.handleJobCrackedHashAck(msg)
+
 	case wstypes.DownloadFileRequestType:
 		return h.handleDownloadFileRequest(msg)
 
 	case wstypes.DeleteFileRequestType:
 		return h.handleDeleteFileRequest(msg)
 
+	case wstypes.BenchmarkRequestType:
+		return h.handleBenchmarkRequest(msg)
+
+	case wstypes.ThermalPolicyType:
+		return h.handleThermalPolicy(msg)
+
 	default:
 		return fmt.Errorf("unrecognized message type: %q", msg.Type)
 	}
@@ -182,9 +206,13 @@ func run(conf *config.Config) error {
 		conn:             conn,
 		conf:             conf,
 		activeJobs:       make(map[string]*ActiveJob),
+		recoverableJobs:  make(map[string]jobCheckpoint),
 		downloadLockfile: downloadLockfile,
 	}
+	h.loadCheckpoints()
+	h.crackSpool = newCrackSpool(h.stateDirectory("cracked-spool"))
 
+	conn.OnConnect = h.onConnect
 	conn.Setup()
 
 	errs := make(chan error)
@@ -47,12 +47,19 @@ func (h *Handler) sendHeartbeat() error {
 		Version:        version.Version(),
 		AgentStartTime: startTime.Unix(),
 		ActiveJobIDs:   make([]string, 0),
+
+		MaxConcurrentJobs: h.conf.MaxConcurrentJobs,
 	}
 
 	for id := range h.activeJobs {
 		payload.ActiveJobIDs = append(payload.ActiveJobIDs, id)
 	}
 
+	// Until the server has decided what to do with them, so it doesn't give up on them in the meantime
+	for id := range h.recoverableJobs {
+		payload.ActiveJobIDs = append(payload.ActiveJobIDs, id)
+	}
+
 	listFiles, err := getFileDTOs(h.conf.ListfileDirectory)
 	if err != nil {
 		return err
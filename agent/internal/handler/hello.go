@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"fmt"
+	"runtime"
+
+	"log"
+
+	"github.com/lachlan2k/phatcrack/agent/internal/hashcat"
+	"github.com/lachlan2k/phatcrack/agent/internal/util"
+	"github.com/lachlan2k/phatcrack/agent/internal/version"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+)
+
+// Works out what hashcat and the hardware can do. This doesn't change while we're running, so it's only done once
+func (h *Handler) getCapabilities() wstypes.AgentHelloDTO {
+	h.capabilitiesOnce.Do(func() {
+		caps := wstypes.AgentHelloDTO{
+			Version: version.Version(),
+			OS:      runtime.GOOS,
+			Arch:    runtime.GOARCH,
+			Errors:  []string{},
+		}
+
+		hashcatVersion, err := hashcat.Version(h.conf)
+		if err != nil {
+			caps.Errors = append(caps.Errors, fmt.Sprintf("couldn't get hashcat version: %v", err))
+		}
+		caps.HashcatVersion = hashcatVersion
+
+		devices, err := hashcat.BackendDevices(h.conf)
+		if err != nil {
+			caps.Errors = append(caps.Errors, fmt.Sprintf("couldn't get backend devices: %v", err))
+		}
+		caps.Devices = devices
+
+		hashTypes, err := hashcat.SupportedHashTypes(h.conf)
+		if err != nil {
+			caps.Errors = append(caps.Errors, fmt.Sprintf("couldn't get supported hash types: %v", err))
+		}
+		caps.SupportedHashTypes = hashTypes
+
+		h.capabilities = caps
+	})
+
+	return h.capabilities
+}
+
+// Called on every (re)connect, so the server always has an up to date picture of us
+func (h *Handler) sendHello() {
+	hello := h.getCapabilities()
+	hello.RecoverableJobs = h.getRecoverableJobs()
+
+	// Unlike everything else, free space changes as files come and go
+	if h.conf.ListfileDirectory != "" {
+		diskFree, err := util.DiskFree(h.conf.ListfileDirectory)
+		if err != nil {
+			hello.Errors = append(append([]string{}, hello.Errors...), fmt.Sprintf("couldn't get free disk space: %v", err))
+		}
+		hello.ListfileDiskFree = diskFree
+	}
+
+	for _, err := range hello.Errors {
+		log.Printf("WARN: %s", err)
+	}
+
+	err := h.sendMessage(wstypes.AgentHelloType, hello)
+	if err != nil {
+		log.Printf("Failed to send hello: %v", err)
+	}
+}
+
+func (h *Handler) onConnect() {
+	h.sendHello()
+	h.resendSpooledCrackedHashes()
+}
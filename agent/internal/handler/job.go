@@ -30,6 +30,15 @@ func (h *Handler) handleJobKill(msg *wstypes.Message) error {
 	return h.killJob(payload)
 }
 
+func (h *Handler) handleJobPause(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.JobPauseDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to job pause dto: %v", msg.Payload, err)
+	}
+
+	return h.pauseJob(payload)
+}
+
 func (h *Handler) sendJobStarted(jobId string, hashcatCommand string) {
 	h.sendMessage(wstypes.JobStartedType, wstypes.JobStartedDTO{
 		JobID:          jobId,
@@ -54,7 +63,7 @@ func (h *Handler) sendJobStderrLine(jobId, line string) {
 	})
 }
 
-func (h *Handler) sendJobExited(jobId string, reason string, err error) {
+func (h *Handler) sendJobExited(jobId string, reason string, paused bool, restorePoint int64, err error) {
 	errStr := ""
 	if err != nil {
 		errStr = err.Error()
@@ -73,14 +82,26 @@ func (h *Handler) sendJobExited(jobId string, reason string, err error) {
 		Error:      errStr,
 		StopReason: reason,
 		Time:       time.Now(),
+
+		Paused:       paused,
+		RestorePoint: restorePoint,
 	})
 }
 
-func (h *Handler) sendJobCrackedHash(jobId string, result hashcattypes.HashcatResult) {
-	h.sendMessage(wstypes.JobCrackedHashType, wstypes.JobCrackedHashDTO{
-		JobID:  jobId,
-		Result: result,
-	})
+func (h *Handler) sendJobCrackedHashes(jobId string, results []hashcattypes.HashcatResult) {
+	msg := wstypes.JobCrackedHashBatchDTO{
+		JobID:   jobId,
+		Results: results,
+	}
+
+	// Once it's in the spool, it'll get to the server eventually, even if the connection drops or we're restarted
+	spooled, err := h.crackSpool.add(msg)
+	if err != nil {
+		log.Printf("WARN: couldn't spool cracked hashes for job %q, sending them without waiting to hear back: %v", jobId, err)
+		spooled = msg
+	}
+
+	h.sendMessage(wstypes.JobCrackedHashBatchType, spooled)
 }
 
 func (h *Handler) sendJobStatusUpdate(jobId string, status hashcattypes.HashcatStatus) {
@@ -98,6 +119,13 @@ func (h *Handler) sendJobFailedToStart(jobId string, err error) {
 	})
 }
 
+// Fast hash types can crack thousands of hashes a second, so they're sent in batches rather than a message each
+// A batch is sent once it's full, or has been waiting long enough
+const (
+	crackedHashBatchSize     = 500
+	crackedHashBatchInterval = time.Second
+)
+
 var backoffTable = []util.BackoffEntry{
 	{
 		AfterTime: time.Duration(0),
@@ -125,12 +153,27 @@ func (h *Handler) runJob(job wstypes.JobStartDTO) error {
 	h.jobsLock.Lock()
 	defer h.jobsLock.Unlock()
 
+	return h.runJobUnsafe(job)
+}
+
+func (h *Handler) runJobUnsafe(job wstypes.JobStartDTO) error {
 	_, alredyExists := h.activeJobs[job.ID]
 	if alredyExists {
 		return fmt.Errorf("job %q already exists", job.ID)
 	}
 
-	sess, err := hashcat.NewHashcatSession(job.ID, job.TargetHashes, hashcat.HashcatParams(job.HashcatParams), h.conf)
+	if !isValidJobID(job.ID) {
+		err := fmt.Errorf("invalid job id %q", job.ID)
+		h.sendJobFailedToStart(job.ID, err)
+		return err
+	}
+
+	// We're starting over, so whatever we had from before a restart is no use
+	h.discardCheckpointUnsafe(job.ID)
+
+	params := applyThermalPolicy(hashcat.HashcatParams(job.HashcatParams), h.getThermalPolicy())
+
+	sess, err := hashcat.NewHashcatSession(job.ID, job.TargetHashes, job.AssociatedHints, params, h.conf, h.jobDirectory(job.ID))
 	if err != nil {
 		h.sendJobFailedToStart(job.ID, err)
 		return err
@@ -138,9 +181,20 @@ func (h *Handler) runJob(job wstypes.JobStartDTO) error {
 
 	log.Printf("Starting job %q", job.ID)
 
-	err = sess.Start()
+	return h.startSessionUnsafe(job, sess, jobCheckpoint{
+		Job:         job,
+		SessionName: sess.SessionName,
+		RestoreFile: sess.RestoreFile,
+		OutFile:     sess.OutFile(),
+	})
+}
+
+// Runs the session, keeping the job's checkpoint up to date as it goes, and tells the server what's happening
+func (h *Handler) startSessionUnsafe(job wstypes.JobStartDTO, sess *hashcat.HashcatSession, checkpoint jobCheckpoint) error {
+	err := sess.Start()
 	if err != nil {
 		h.sendJobFailedToStart(job.ID, err)
+		sess.Cleanup()
 		return err
 	}
 
@@ -151,6 +205,12 @@ func (h *Handler) runJob(job wstypes.JobStartDTO) error {
 
 	h.activeJobs[job.ID] = activeJob
 
+	jobDir := h.jobDirectory(job.ID)
+	err = saveCheckpoint(jobDir, checkpoint)
+	if err != nil {
+		log.Printf("WARN: couldn't save checkpoint for job %q: %v", job.ID, err)
+	}
+
 	go func() {
 		h.sendJobStarted(job.ID, sess.CmdLine())
 
@@ -164,6 +224,42 @@ func (h *Handler) runJob(job wstypes.JobStartDTO) error {
 		statusBackoff.Start()
 		stdoutBackoff.Start()
 
+		// Status updates to the server are rate limited, so keep track of the latest restore point ourselves
+		restorePoint := checkpoint.RestorePoint
+
+		crackedBatch := []hashcattypes.HashcatResult{}
+		crackedBatchOffset := checkpoint.OutfileOffset
+		crackedBatchTicker := time.NewTicker(crackedHashBatchInterval)
+		defer crackedBatchTicker.Stop()
+
+		sendCrackedBatch := func() {
+			if len(crackedBatch) == 0 {
+				return
+			}
+			h.sendJobCrackedHashes(job.ID, crackedBatch)
+			crackedBatch = []hashcattypes.HashcatResult{}
+
+			// Only checkpoint past them once they're spooled, or we'd lose them if we died in between
+			checkpoint.OutfileOffset = crackedBatchOffset
+		}
+
+		addCrackedHash := func(result hashcat.CrackedHash) {
+			crackedBatch = append(crackedBatch, hashcattypes.HashcatResult{
+				Timestamp:    result.Timestamp,
+				Hash:         result.Hash,
+				PlaintextHex: result.PlaintextHex,
+			})
+			crackedBatchOffset = result.OutfileOffset
+
+			if len(crackedBatch) >= crackedHashBatchSize {
+				sendCrackedBatch()
+			}
+		}
+
+		// Closed once the whole outfile has been read, which can happen before or after hashcat is done
+		crackedHashes := sess.CrackedHashes
+		var exitErr error
+
 	procLoop:
 		for {
 			select {
@@ -176,24 +272,47 @@ func (h *Handler) runJob(job wstypes.JobStartDTO) error {
 			case stderrLine := <-sess.StderrMessages:
 				h.sendJobStderrLine(job.ID, stderrLine)
 
-			case result := <-sess.CrackedHashes:
-				h.sendJobCrackedHash(job.ID, hashcattypes.HashcatResult{
-					Timestamp:    result.Timestamp,
-					Hash:         result.Hash,
-					PlaintextHex: result.PlaintextHex,
-				})
+			case result, ok := <-crackedHashes:
+				if !ok {
+					crackedHashes = nil
+					continue
+				}
+				addCrackedHash(result)
+
+			case <-crackedBatchTicker.C:
+				sendCrackedBatch()
 
 			case status := <-sess.StatusUpdates:
+				restorePoint = int64(status.RestorePoint)
 				if statusBackoff.Ready() {
 					h.sendJobStatusUpdate(job.ID, status)
 				}
+				h.checkThermalLimit(activeJob, status)
+
+				// Hashcat tells us how it's going every few seconds, which is often enough to checkpoint
+				// If we die in between, we'll just send the server a few cracked hashes it already has
+				checkpoint.RestorePoint = restorePoint
+				err := saveCheckpoint(jobDir, checkpoint)
+				if err != nil {
+					log.Printf("WARN: couldn't save checkpoint for job %q: %v", job.ID, err)
+				}
 
-			case err := <-sess.DoneChan:
-				h.sendJobExited(job.ID, activeJob.stopReason, err)
+			case exitErr = <-sess.DoneChan:
 				break procLoop
 			}
 		}
 
+		// Anything left in the outfile has to be sent before Cleanup deletes it
+		// And before we say we've exited, so the server has all of the job's results by then
+		if crackedHashes != nil {
+			for result := range crackedHashes {
+				addCrackedHash(result)
+			}
+		}
+		sendCrackedBatch()
+
+		h.sendJobExited(job.ID, activeJob.stopReason, activeJob.paused, restorePoint, exitErr)
+
 		sess.Kill()
 		sess.Cleanup()
 
@@ -210,6 +329,10 @@ func (h *Handler) killJob(jobMsg wstypes.JobKillDTO) error {
 	h.jobsLock.Lock()
 	defer h.jobsLock.Unlock()
 
+	if h.discardCheckpointUnsafe(jobMsg.JobID) {
+		return nil
+	}
+
 	job, ok := h.activeJobs[jobMsg.JobID]
 	if !ok {
 		// We aren't running it so alg
@@ -220,3 +343,18 @@ func (h *Handler) killJob(jobMsg wstypes.JobKillDTO) error {
 
 	return job.sess.Kill()
 }
+
+// Pausing is just a kill, but we let the server know where we got up to so it can resume from there later
+func (h *Handler) pauseJob(jobMsg wstypes.JobPauseDTO) error {
+	h.jobsLock.Lock()
+	defer h.jobsLock.Unlock()
+
+	job, ok := h.activeJobs[jobMsg.JobID]
+	if !ok {
+		return nil
+	}
+
+	job.paused = true
+
+	return job.sess.Kill()
+}
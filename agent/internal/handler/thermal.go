@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"log"
+
+	"github.com/lachlan2k/phatcrack/agent/internal/hashcat"
+	"github.com/lachlan2k/phatcrack/agent/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+)
+
+func (h *Handler) handleThermalPolicy(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.ThermalPolicyDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to thermal policy dto: %v", msg.Payload, err)
+	}
+
+	switch payload.Action {
+	case "", wstypes.ThermalActionPause, wstypes.ThermalActionKill:
+	default:
+		return fmt.Errorf("unknown thermal policy action %q", payload.Action)
+	}
+
+	h.thermalLock.Lock()
+	defer h.thermalLock.Unlock()
+
+	h.thermalOverride = payload
+	return nil
+}
+
+// Our config, with anything the server has overridden
+func (h *Handler) getThermalPolicy() wstypes.ThermalPolicyDTO {
+	h.thermalLock.Lock()
+	defer h.thermalLock.Unlock()
+
+	policy := h.conf.ThermalPolicy
+	if h.thermalOverride.TempAbort > 0 {
+		policy.TempAbort = h.thermalOverride.TempAbort
+	}
+	if h.thermalOverride.MaxTemp > 0 {
+		policy.MaxTemp = h.thermalOverride.MaxTemp
+	}
+	if h.thermalOverride.Action != "" {
+		policy.Action = h.thermalOverride.Action
+	}
+	return policy
+}
+
+// Hashcat's own limit is passed along with the job's other args
+func applyThermalPolicy(params hashcat.HashcatParams, policy wstypes.ThermalPolicyDTO) hashcat.HashcatParams {
+	if policy.TempAbort > 0 {
+		params.AdditionalArgs = append(slices.Clone(params.AdditionalArgs), "--hwmon-temp-abort", strconv.Itoa(policy.TempAbort))
+	}
+	return params
+}
+
+// Stops the job if any of the devices in its latest status are too hot
+func (h *Handler) checkThermalLimit(job *ActiveJob, status hashcattypes.HashcatStatus) {
+	policy := h.getThermalPolicy()
+	if policy.MaxTemp <= 0 {
+		return
+	}
+
+	i := slices.IndexFunc(status.Devices, func(device hashcattypes.HashcatStatusDevice) bool {
+		return device.Temp >= policy.MaxTemp
+	})
+	if i == -1 {
+		return
+	}
+	device := status.Devices[i]
+
+	h.jobsLock.Lock()
+	defer h.jobsLock.Unlock()
+
+	if job.stopReason != "" || job.paused {
+		// Already on its way out
+		return
+	}
+
+	log.Printf("Device %d (%s) of job %q is at %d°C, over the limit of %d°C, action: %s", device.DeviceID, device.DeviceName, job.job.ID, device.Temp, policy.MaxTemp, policy.Action)
+
+	job.stopReason = wstypes.JobStopReasonThermalLimit
+	job.paused = policy.Action == wstypes.ThermalActionPause
+
+	h.sendMessage(wstypes.ThermalEventType, wstypes.ThermalEventDTO{
+		JobID:      job.job.ID,
+		DeviceID:   device.DeviceID,
+		DeviceName: device.DeviceName,
+		Temp:       device.Temp,
+		MaxTemp:    policy.MaxTemp,
+		Action:     policy.Action,
+		Time:       time.Now(),
+	})
+
+	err := job.sess.Kill()
+	if err != nil {
+		log.Printf("Failed to stop job %q for going over the thermal limit: %v", job.job.ID, err)
+	}
+}
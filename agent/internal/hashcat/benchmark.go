@@ -0,0 +1,69 @@
+package hashcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lachlan2k/phatcrack/agent/internal/config"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+)
+
+// Slow hash types can take hashcat a while to settle on a speed, but it shouldn't be left hanging forever
+const benchmarkTimeout = 5 * time.Minute
+
+// Machine readable benchmark lines look like DEVICE_ID:HASH_MODE:CORE_CLOCK:MEMORY_CLOCK:EXEC_RUNTIME_MS:SPEED_H_S
+func parseBenchmarkOutput(out string) ([]hashcattypes.HashcatBenchmarkDevice, error) {
+	devices := []hashcattypes.HashcatBenchmarkDevice{}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 6 {
+			continue
+		}
+
+		deviceId, err := strconv.Atoi(fields[0])
+		if err != nil {
+			// Not a result line, hashcat prints a few other bits and pieces too
+			continue
+		}
+
+		execRuntime, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse exec runtime from benchmark line %q: %v", line, err)
+		}
+
+		speed, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse speed from benchmark line %q: %v", line, err)
+		}
+
+		devices = append(devices, hashcattypes.HashcatBenchmarkDevice{
+			DeviceID:      deviceId,
+			Speed:         int64(speed),
+			ExecRuntimeMs: execRuntime,
+		})
+	}
+
+	if len(devices) == 0 {
+		return nil, errors.New("hashcat didn't report any benchmark results")
+	}
+
+	return devices, nil
+}
+
+// Runs hashcat's benchmark for a single hash type, returning the speed of each device
+func RunBenchmark(conf *config.Config, hashType uint) ([]hashcattypes.HashcatBenchmarkDevice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), benchmarkTimeout)
+	defer cancel()
+
+	out, err := hashcatOutput(ctx, conf, "--benchmark", "-m", fmtUint(hashType), "--machine-readable")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBenchmarkOutput(string(out))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -37,39 +38,9 @@ const (
 	AttackModeMask       = 3
 	AttackModeHybridDM   = 6
 	AttackModeHybridMD   = 7
-)
-
-func (params HashcatParams) Validate() error {
-	switch params.AttackMode {
-	case AttackModeDictionary:
-		if len(params.WordlistFilenames) != 1 {
-			return fmt.Errorf("expected 1 wordlist for dictionary attack (%d), but %d given", AttackModeDictionary, len(params.WordlistFilenames))
-		}
 
-	case AttackModeCombinator:
-		if len(params.WordlistFilenames) != 2 {
-			return fmt.Errorf("expected 2 wordlists for combinator attack (%d), but %d given", AttackModeCombinator, len(params.WordlistFilenames))
-		}
-
-	case AttackModeMask:
-		if params.Mask == "" {
-			return fmt.Errorf("using mask attack (%d), but no mask was given", AttackModeMask)
-		}
-
-	case AttackModeHybridDM, AttackModeHybridMD:
-		if params.Mask == "" {
-			return fmt.Errorf("using hybrid attack (%d), but no mask was given", params.AttackMode)
-		}
-		if len(params.WordlistFilenames) != 1 {
-			return fmt.Errorf("using hybrid attack (%d), but %d wordlist were given", params.AttackMode, len(params.WordlistFilenames))
-		}
-
-	default:
-		return fmt.Errorf("unsupported attack mode %d", params.AttackMode)
-	}
-
-	return nil
-}
+	AttackModeAssociation = 9
+)
 
 type uintIf interface {
 	uint | uint8 | uint16 | uint32 | uint64
@@ -120,15 +91,16 @@ func (params HashcatParams) maskArgs() ([]string, error) {
 	return args, nil
 }
 
-func (params HashcatParams) ToCmdArgs(conf *config.Config, session, tempHashFile string, outFile string) (args []string, err error) {
-	if err = params.Validate(); err != nil {
+func (params HashcatParams) ToCmdArgs(conf *config.Config, sessionName, restoreFile, tempHashFile string, outFile string, hintFile string) (args []string, err error) {
+	if err = hashcattypes.HashcatParams(params).Validate(); err != nil {
 		return
 	}
 
 	args = append(
 		args,
 		"--quiet",
-		"--session", "sess-"+session+"_"+uuid.New().String(),
+		"--session", sessionName,
+		"--restore-file-path", restoreFile,
 		"--outfile-format", "1,3,5",
 		"--outfile", outFile,
 		"--status",
@@ -161,12 +133,24 @@ func (params HashcatParams) ToCmdArgs(conf *config.Config, session, tempHashFile
 		args = append(args, "--limit", strconv.FormatInt(params.Limit, 10))
 	}
 
+	// So jobs sharing the agent each get their own devices
+	if len(params.BackendDevices) > 0 {
+		deviceIds := make([]string, len(params.BackendDevices))
+		for i, deviceId := range params.BackendDevices {
+			deviceIds[i] = strconv.Itoa(deviceId)
+		}
+		args = append(args, "--backend-devices", strings.Join(deviceIds, ","))
+	}
+
 	wordlists := make([]string, len(params.WordlistFilenames))
-	for i, list := range params.WordlistFilenames {
-		wordlists[i] = filepath.Join(conf.ListfileDirectory, filepath.Clean(list))
-		if _, err = os.Stat(wordlists[i]); err != nil {
-			err = fmt.Errorf("provided wordlist %q couldn't be opened on filesystem", wordlists[i])
-			return
+	// Association attacks are given their hints directly, rather than using the wordlist on disk
+	if params.AttackMode != AttackModeAssociation {
+		for i, list := range params.WordlistFilenames {
+			wordlists[i] = filepath.Join(conf.ListfileDirectory, filepath.Clean(list))
+			if _, err = os.Stat(wordlists[i]); err != nil {
+				err = fmt.Errorf("provided wordlist %q couldn't be opened on filesystem", wordlists[i])
+				return
+			}
 		}
 	}
 
@@ -199,6 +183,12 @@ func (params HashcatParams) ToCmdArgs(conf *config.Config, session, tempHashFile
 
 	case AttackModeHybridMD:
 		args = append(args, params.Mask, wordlists[0])
+
+	case AttackModeAssociation:
+		for _, rule := range rules {
+			args = append(args, "-r", rule)
+		}
+		args = append(args, hintFile)
 	}
 
 	switch params.AttackMode {
@@ -237,16 +227,25 @@ func findBinary(conf *config.Config) (path string, err error) {
 }
 
 type HashcatSession struct {
-	proc               *exec.Cmd
-	hashFile           *os.File
-	outFile            *os.File
-	charsetFiles       []*os.File
-	shardedCharsetFile *os.File
-	CrackedHashes      chan HashcatResult
-	StatusUpdates      chan HashcatStatus
-	StderrMessages     chan string
-	StdoutLines        chan string
-	DoneChan           chan error
+	proc *exec.Cmd
+	// Everything hashcat needs for the session is kept in here, so it's still around if the agent is restarted
+	dir           string
+	outFile       string
+	outfileOffset int64
+
+	SessionName    string
+	RestoreFile    string
+	CrackedHashes  chan CrackedHash
+	StatusUpdates  chan HashcatStatus
+	StderrMessages chan string
+	StdoutLines    chan string
+	DoneChan       chan error
+}
+
+// A result from the outfile, along with where the next one starts, so a restored session knows where to pick up reading from
+type CrackedHash struct {
+	HashcatResult
+	OutfileOffset int64
 }
 
 func (sess *HashcatSession) Start() error {
@@ -270,10 +269,13 @@ func (sess *HashcatSession) Start() error {
 		return fmt.Errorf("couldn't start hashcat: %w", err)
 	}
 
-	tailer, err := tail.TailFile(sess.outFile.Name(), tail.Config{Follow: true})
+	tailer, err := tail.TailFile(sess.outFile, tail.Config{
+		Follow:   true,
+		Location: &tail.SeekInfo{Offset: sess.outfileOffset, Whence: io.SeekStart},
+	})
 	if err != nil {
 		sess.Kill()
-		return fmt.Errorf("couldn't tail outfile %q: %w", sess.outFile.Name(), err)
+		return fmt.Errorf("couldn't tail outfile %q: %w", sess.outFile, err)
 	}
 
 	go func() {
@@ -300,12 +302,17 @@ func (sess *HashcatSession) Start() error {
 				continue
 			}
 
-			sess.CrackedHashes <- HashcatResult{
-				Timestamp:    time.Unix(timestampI, 0),
-				Hash:         hash,
-				PlaintextHex: plainHex,
+			sess.CrackedHashes <- CrackedHash{
+				HashcatResult: HashcatResult{
+					Timestamp:    time.Unix(timestampI, 0),
+					Hash:         hash,
+					PlaintextHex: plainHex,
+				},
+				OutfileOffset: tLine.SeekInfo.Offset,
 			}
 		}
+
+		close(sess.CrackedHashes)
 	}()
 
 	go func() {
@@ -334,11 +341,10 @@ func (sess *HashcatSession) Start() error {
 		}
 
 		done := sess.proc.Wait()
-		// Give us a hot moment to read any cracked hashes that are still being written to disk
-		time.Sleep(time.Second)
+		// Hashcat won't write anything else, so read the rest of the outfile before we stop following it
+		// CrackedHashes is closed once that's all been read
+		tailer.StopAtEOF()
 		sess.DoneChan <- done
-
-		tailer.Kill(nil)
 	}()
 
 	go func() {
@@ -366,25 +372,11 @@ func (sess *HashcatSession) Kill() error {
 	return err
 }
 
+// Removes the session's directory, so it can't be restored any more
 func (sess *HashcatSession) Cleanup() {
-	if sess.hashFile != nil {
-		os.Remove(sess.hashFile.Name())
-		sess.hashFile = nil
-	}
-
-	if sess.outFile != nil {
-		os.Remove(sess.outFile.Name())
-		sess.outFile = nil
-	}
-
-	for _, f := range sess.charsetFiles {
-		if f != nil {
-			os.Remove(f.Name())
-		}
-	}
-
-	if sess.shardedCharsetFile != nil {
-		os.Remove(sess.shardedCharsetFile.Name())
+	if sess.dir != "" {
+		os.RemoveAll(sess.dir)
+		sess.dir = ""
 	}
 }
 
@@ -392,33 +384,34 @@ func (sess *HashcatSession) CmdLine() string {
 	return sess.proc.String()
 }
 
-func NewHashcatSession(id string, hashes []string, params HashcatParams, conf *config.Config) (*HashcatSession, error) {
-	var err error
+func (sess *HashcatSession) OutFile() string {
+	return sess.outFile
+}
 
-	var hashFile *os.File
-	var outFile *os.File
-	var shardedCharsetFile *os.File
-	charsetFiles := []*os.File{}
+func newSession(binaryPath string, args []string, dir string, outFile string, outfileOffset int64, sessionName string, restoreFile string) *HashcatSession {
+	return &HashcatSession{
+		proc:           exec.Command(binaryPath, args...),
+		dir:            dir,
+		outFile:        outFile,
+		outfileOffset:  outfileOffset,
+		SessionName:    sessionName,
+		RestoreFile:    restoreFile,
+		CrackedHashes:  make(chan CrackedHash, 5),
+		StatusUpdates:  make(chan HashcatStatus, 5),
+		StderrMessages: make(chan string, 5),
+		StdoutLines:    make(chan string, 5),
+		DoneChan:       make(chan error),
+	}
+}
 
+// dir is where the session's files are kept, which is created if needed, and removed by Cleanup
+func NewHashcatSession(id string, hashes []string, hints []string, params HashcatParams, conf *config.Config, dir string) (sess *HashcatSession, err error) {
 	defer func() {
 		if err == nil {
 			return
 		}
-		// We returned because of an error, clean up temp files
-		if hashFile != nil {
-			os.Remove(hashFile.Name())
-		}
-		if outFile != nil {
-			os.Remove(outFile.Name())
-		}
-		if shardedCharsetFile != nil {
-			os.Remove(shardedCharsetFile.Name())
-		}
-		for _, f := range charsetFiles {
-			if f != nil {
-				os.Remove(f.Name())
-			}
-		}
+		// We returned because of an error, clean up the files we made
+		os.RemoveAll(dir)
 	}()
 
 	binaryPath, err := findBinary(conf)
@@ -426,39 +419,46 @@ func NewHashcatSession(id string, hashes []string, params HashcatParams, conf *c
 		return nil, err
 	}
 
-	hashFile, err = os.CreateTemp(os.TempDir(), "phatcrack-hashes")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make a directory for the session: %v", err)
+	}
+
+	hashFile, err := os.CreateTemp(dir, "phatcrack-hashes")
 	if err != nil {
 		return nil, fmt.Errorf("couldn't make a temp file to store hashes: %v", err)
 	}
+	defer hashFile.Close()
 	hashFile.Chmod(0600)
 
-	outFile, err = os.CreateTemp(os.TempDir(), "phatcrack-output")
+	outFile, err := os.CreateTemp(dir, "phatcrack-output")
 	if err != nil {
 		return nil, fmt.Errorf("couldn't make a temp file to store output: %v", err)
 	}
+	defer outFile.Close()
 	outFile.Chmod(0600)
 
-	charsetFiles = []*os.File{}
 	for i, charset := range params.MaskCustomCharsets {
-		charsetFile, err := os.CreateTemp(os.TempDir(), "phatcrack-charset")
+		charsetFile, err := os.CreateTemp(dir, "phatcrack-charset")
 		if err != nil {
 			return nil, fmt.Errorf("couldn't make a temp file to store charset")
 		}
+		defer charsetFile.Close()
 		_, err = charsetFile.Write([]byte(charset))
 		if err != nil {
 			return nil, err
 		}
 
 		params.MaskCustomCharsets[i] = charsetFile.Name()
-		charsetFiles = append(charsetFiles, charsetFile)
 	}
 
 	if params.MaskShardedCharset != "" {
-		shardedCharsetFile, err = os.CreateTemp(os.TempDir(), "phatcrack-charset")
+		shardedCharsetFile, err := os.CreateTemp(dir, "phatcrack-charset")
 		if err != nil {
 			return nil, fmt.Errorf("couldn't make a temp file to store charset")
 		}
-		outFile.Chmod(0600)
+		defer shardedCharsetFile.Close()
+		shardedCharsetFile.Chmod(0600)
 		_, err = shardedCharsetFile.Write([]byte(params.MaskShardedCharset))
 		if err != nil {
 			return nil, err
@@ -467,7 +467,34 @@ func NewHashcatSession(id string, hashes []string, params HashcatParams, conf *c
 		params.MaskShardedCharset = shardedCharsetFile.Name()
 	}
 
-	args, err := params.ToCmdArgs(conf, id, hashFile.Name(), outFile.Name())
+	hintFilename := ""
+	if params.AttackMode == AttackModeAssociation {
+		// Hashcat pairs the nth hash with the nth hint, so these have to line up exactly
+		if len(hints) != len(hashes) {
+			return nil, fmt.Errorf("association attack has %d hashes, but %d hints", len(hashes), len(hints))
+		}
+
+		hintFile, err := os.CreateTemp(dir, "phatcrack-hints")
+		if err != nil {
+			return nil, fmt.Errorf("couldn't make a temp file to store hints: %v", err)
+		}
+		defer hintFile.Close()
+		hintFile.Chmod(0600)
+
+		for _, hint := range hints {
+			_, err = hintFile.WriteString(hint + "\n")
+			if err != nil {
+				return nil, fmt.Errorf("couldn't write hint to file: %v", err)
+			}
+		}
+
+		hintFilename = hintFile.Name()
+	}
+
+	sessionName := "sess-" + id + "_" + uuid.New().String()
+	restoreFile := filepath.Join(dir, "hashcat.restore")
+
+	args, err := params.ToCmdArgs(conf, sessionName, restoreFile, hashFile.Name(), outFile.Name(), hintFilename)
 	if err != nil {
 		return nil, err
 	}
@@ -479,16 +506,27 @@ func NewHashcatSession(id string, hashes []string, params HashcatParams, conf *c
 		}
 	}
 
-	return &HashcatSession{
-		proc:               exec.Command(binaryPath, args...),
-		hashFile:           hashFile,
-		outFile:            outFile,
-		charsetFiles:       charsetFiles,
-		shardedCharsetFile: shardedCharsetFile,
-		CrackedHashes:      make(chan HashcatResult, 5),
-		StatusUpdates:      make(chan HashcatStatus, 5),
-		StderrMessages:     make(chan string, 5),
-		StdoutLines:        make(chan string, 5),
-		DoneChan:           make(chan error),
-	}, nil
+	return newSession(binaryPath, args, dir, outFile.Name(), 0, sessionName, restoreFile), nil
+}
+
+// Picks an interrupted session back up from hashcat's restore file, which has all of the original arguments in it
+// outfileOffset is how much of the outfile we had already dealt with
+func RestoreHashcatSession(dir string, sessionName string, restoreFile string, outFile string, outfileOffset int64, conf *config.Config) (*HashcatSession, error) {
+	binaryPath, err := findBinary(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(restoreFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find restore file %q: %v", restoreFile, err)
+	}
+
+	args := []string{
+		"--session", sessionName,
+		"--restore",
+		"--restore-file-path", restoreFile,
+	}
+
+	return newSession(binaryPath, args, dir, outFile, outfileOffset, sessionName, restoreFile), nil
 }
@@ -0,0 +1,171 @@
+package hashcat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lachlan2k/phatcrack/agent/internal/config"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+)
+
+// Backend information mode has to initialise every device, which can take a little while
+const infoTimeout = time.Minute
+
+// Runs hashcat to completion and returns what it wrote to stdout
+func hashcatOutput(ctx context.Context, conf *config.Config, args ...string) ([]byte, error) {
+	binaryPath, err := findBinary(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, binaryPath, args...)
+	// Same as a normal session, hashcat needs to be run from its own directory to find its resources
+	cmd.Dir = filepath.Dir(cmd.Path)
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("hashcat didn't finish in time")
+	}
+	if err != nil {
+		ee, ok := err.(*exec.ExitError)
+		if ok {
+			return nil, fmt.Errorf("hashcat gave an exit error: %w, %q", ee, string(ee.Stderr))
+		}
+		return nil, fmt.Errorf("couldn't run hashcat: %w", err)
+	}
+
+	return out, nil
+}
+
+func Version(conf *config.Config) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), infoTimeout)
+	defer cancel()
+
+	out, err := hashcatOutput(ctx, conf, "--version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Every hash type this build of hashcat knows about
+func SupportedHashTypes(conf *config.Config) ([]uint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), infoTimeout)
+	defer cancel()
+
+	out, err := hashcatOutput(ctx, conf, "--hash-info", "--machine-readable", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+
+	var hashInfo map[string]json.RawMessage
+	err = json.Unmarshal(out, &hashInfo)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal hash info: %v", err)
+	}
+
+	hashTypes := make([]uint, 0, len(hashInfo))
+	for key := range hashInfo {
+		hashType, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		hashTypes = append(hashTypes, uint(hashType))
+	}
+	slices.Sort(hashTypes)
+
+	return hashTypes, nil
+}
+
+var backendSectionRegex = regexp.MustCompile(`^(\w+) Info:$`)
+var backendDeviceRegex = regexp.MustCompile(`^Backend Device ID #0*(\d+)(?: \(Alias: #0*(\d+)\))?`)
+var backendPropertyRegex = regexp.MustCompile(`^([\w.()]+?)\.*: (.*)$`)
+
+// Picks the devices out of `hashcat -I`, which looks like:
+//
+//	OpenCL Info:
+//	...
+//	  Backend Device ID #2 (Alias: #1)
+//	    Type...........: GPU
+//	    Name...........: NVIDIA GeForce RTX 3090
+func parseBackendInfo(out string) []hashcattypes.HashcatBackendDevice {
+	devices := []hashcattypes.HashcatBackendDevice{}
+	backend := ""
+	var device *hashcattypes.HashcatBackendDevice
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+
+		if match := backendSectionRegex.FindStringSubmatch(line); match != nil {
+			backend = match[1]
+			device = nil
+			continue
+		}
+
+		if match := backendDeviceRegex.FindStringSubmatch(line); match != nil {
+			deviceId, _ := strconv.Atoi(match[1])
+			aliasOf, _ := strconv.Atoi(match[2])
+
+			devices = append(devices, hashcattypes.HashcatBackendDevice{
+				DeviceID: deviceId,
+				Backend:  backend,
+				AliasOf:  aliasOf,
+			})
+			device = &devices[len(devices)-1]
+
+			// Only OpenCL tells us the type, everything else only deals with GPUs
+			if backend != "OpenCL" {
+				device.Type = "GPU"
+			}
+			continue
+		}
+
+		match := backendPropertyRegex.FindStringSubmatch(line)
+		if match == nil || device == nil {
+			continue
+		}
+
+		value := strings.TrimSpace(match[2])
+		switch match[1] {
+		case "Type":
+			device.Type = value
+		case "Name":
+			device.Name = value
+		case "Vendor":
+			device.Vendor = value
+		case "Processor(s)":
+			device.Processors, _ = strconv.Atoi(value)
+		case "Clock":
+			device.ClockMHz, _ = strconv.Atoi(value)
+		case "Memory.Total":
+			// e.g. "24257 MB (limited to 6064 MB allocatable in one block)"
+			memory, _, _ := strings.Cut(value, " ")
+			device.MemoryTotalMB, _ = strconv.ParseInt(memory, 10, 64)
+		case "Driver.Version":
+			device.DriverVersion = value
+		}
+	}
+
+	return devices
+}
+
+// Every compute device hashcat can see, across all of its backends
+func BackendDevices(conf *config.Config) ([]hashcattypes.HashcatBackendDevice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), infoTimeout)
+	defer cancel()
+
+	out, err := hashcatOutput(ctx, conf, "--backend-info")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBackendInfo(string(out)), nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package util
+
+import "golang.org/x/sys/unix"
+
+// How many bytes are free for us to use on the filesystem holding path
+func DiskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	err := unix.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package util
+
+import "golang.org/x/sys/windows"
+
+// How many bytes are free for us to use on the filesystem holding path
+func DiskFree(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	err = windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, &totalBytes, &totalFreeBytes)
+	if err != nil {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
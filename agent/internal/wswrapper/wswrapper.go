@@ -23,6 +23,9 @@ type WSWrapper struct {
 	Headers                http.Header
 	MaximumDropoutTime     time.Duration
 
+	// Called in the background after every successful (re)connect
+	OnConnect func()
+
 	writeChan chan interface{}
 	readChan  chan []byte
 
@@ -156,6 +159,10 @@ func (w *WSWrapper) Run(notifyFirstConn *sync.Cond) error {
 
 		log.Printf("Agent connected")
 
+		if w.OnConnect != nil {
+			go w.OnConnect()
+		}
+
 		err = w.handle()
 		if err != nil {
 			log.Printf("Error when running ws wrapper, reconnecting: %v", err)
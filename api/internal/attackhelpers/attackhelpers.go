@@ -0,0 +1,187 @@
+package attackhelpers
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/fleet"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+)
+
+// Returned when the attack settings themselves are the problem, rather than something going wrong on our end
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func validationErrorf(format string, args ...interface{}) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Checks all wordlists and rulefiles in the params exactly match the ID of a known listfile of the right type
+func CheckListfiles(params hashcattypes.HashcatParams, listfiles []db.Listfile) error {
+	// Check all specified wordlists exactly match the ID of a known wordlist
+	for _, suppliedWordlist := range params.WordlistFilenames {
+		found := false
+		for _, dbListfile := range listfiles {
+			if dbListfile.ID.String() == suppliedWordlist && dbListfile.FileType == db.ListfileTypeWordlist {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return validationErrorf("Invalid wordlist supplied: %q", suppliedWordlist)
+		}
+	}
+
+	// Same for rulefiles
+	for _, suppliedRulefile := range params.RulesFilenames {
+		found := false
+		for _, dbListfile := range listfiles {
+			if dbListfile.ID.String() == suppliedRulefile && dbListfile.FileType == db.ListfileTypeRulefile {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return validationErrorf("Invalid rulefile supplied: %q", suppliedRulefile)
+		}
+	}
+
+	return nil
+}
+
+// Checks the params are valid for an attack on the hashlist, and gets them ready to be stored
+// The hash type is set to the hashlist's, so anything that shouldn't be allowed a different one needs to check that first
+func PrepareHashcatParams(params *hashcattypes.HashcatParams, hashlist *db.Hashlist, listfiles []db.Listfile) error {
+	err := CheckListfiles(*params, listfiles)
+	if err != nil {
+		return err
+	}
+
+	// Don't allow any additional args
+	params.AdditionalArgs = []string{}
+
+	// Only the dispatcher decides which devices a job gets
+	params.BackendDevices = []int{}
+
+	// Enforce correct hashtype
+	params.HashType = uint(hashlist.HashType)
+
+	err = params.Validate()
+	if err != nil {
+		return &ValidationError{Message: err.Error()}
+	}
+
+	// hexlify mask custom charactersets
+	for i := range params.MaskCustomCharsets {
+		params.MaskCustomCharsets[i] = hex.EncodeToString([]byte(params.MaskCustomCharsets[i]))
+	}
+
+	return nil
+}
+
+// Gets the template, or every template in the set, in order
+// Returns db.ErrNotFound if there is no template or template set with that ID
+func GetTemplates(templateId string) ([]db.AttackTemplate, error) {
+	template, err := db.GetAttackTemplate(templateId)
+	if err == nil {
+		return []db.AttackTemplate{*template}, nil
+	}
+	if err != db.ErrNotFound {
+		return nil, err
+	}
+
+	templateSet, err := db.GetAttackTemplateSet(templateId)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []db.AttackTemplate{}
+	for _, id := range templateSet.AttackTemplateIDs {
+		template, err := db.GetAttackTemplate(id)
+		if err == db.ErrNotFound {
+			return nil, validationErrorf("Attack template set refers to a template that no longer exists: %q", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+
+	return templates, nil
+}
+
+// Creates an attack on the hashlist for the template, or for every template in the set
+// Every template is checked before anything is created, so we don't end up with half a set
+func CreateFromTemplate(hashlist *db.Hashlist, templateId string, isDistributed bool, progressString string) ([]*db.Attack, error) {
+	templates, err := GetTemplates(templateId)
+	if err != nil {
+		return nil, err
+	}
+
+	listfiles, err := db.GetAllListfilesAvailableToProject(hashlist.ProjectID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	attacks := make([]*db.Attack, len(templates))
+	for i, template := range templates {
+		params := template.HashcatParams.Data()
+
+		// PrepareHashcatParams would quietly change it to the hashlist's, but a template made for one hash type is no good for another
+		// Templates made in the UI don't have a hash type (it's left as 0), so those can go on any hashlist
+		if params.HashType != 0 && params.HashType != uint(hashlist.HashType) {
+			return nil, validationErrorf("Template %q is for hash type %d, but the hashlist is hash type %d", template.Name, params.HashType, hashlist.HashType)
+		}
+
+		err = PrepareHashcatParams(&params, hashlist, listfiles)
+		if err != nil {
+			if len(templates) > 1 {
+				return nil, validationErrorf("Template %d: %v", i+1, err)
+			}
+			return nil, err
+		}
+
+		attacks[i] = &db.Attack{
+			HashcatParams:  datatypes.NewJSONType(params),
+			IsDistributed:  isDistributed,
+			HashlistID:     hashlist.ID,
+			ProgressString: progressString,
+		}
+	}
+
+	err = db.CreateAttacks(attacks)
+	if err != nil {
+		return nil, err
+	}
+
+	return attacks, nil
+}
+
+// Starts the attack, keeping its progress string up to date as it goes
+// On failure, the progress string is given an error ID that matches up with the logs
+func StartWithProgress(attack *db.Attack, logFields log.Fields) ([]string, error) {
+	attackId := attack.ID.String()
+	db.SetAttackProgressString(attackId, "Processing (this can take a while)..")
+
+	jobIDs, err := fleet.StartAttack(attack)
+	if err != nil {
+		errId := uuid.NewString()
+		db.SetAttackProgressString(attackId, "Error #"+errId)
+		log.WithFields(logFields).WithField("error_id", errId).WithError(err).Warn("Failed to start attack")
+		return nil, err
+	}
+
+	db.SetAttackProgressString(attackId, "")
+	return jobIDs, nil
+}
@@ -0,0 +1,168 @@
+package attacksharder
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/filerepo"
+	"gorm.io/gorm"
+)
+
+var errNoAssociatedHints = errors.New("none of the uncracked hashes could be paired with a hint")
+
+func readHintLines(id string) ([]string, error) {
+	wordlistId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hint wordlist id provided: %q", id)
+	}
+
+	path, err := filerepo.GetPathToFile(wordlistId)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open hint wordlist: %w", err)
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read hint wordlist: %w", err)
+	}
+
+	return lines, nil
+}
+
+// Pairs up each uncracked hash in the hashlist with its hint, for an association (-a 9) attack
+// If the hashlist has usernames, each line of the hint wordlist should be username:hint
+// Otherwise, the nth line of the hint wordlist is the hint for the nth hash, in the order they were added to the hashlist
+func getAssociationPairs(hashlist *db.Hashlist, hintWordlistId string) (hashes []string, hints []string, err error) {
+	lines, err := readHintLines(hintWordlistId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashlistHashes := slices.Clone(hashlist.Hashes)
+	slices.SortFunc(hashlistHashes, func(a, b db.HashlistHash) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	hasUsernames := slices.ContainsFunc(hashlistHashes, func(hash db.HashlistHash) bool {
+		return hash.Username != ""
+	})
+
+	if hasUsernames {
+		hintsByUsername := map[string]string{}
+		for _, line := range lines {
+			username, hint, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			if _, exists := hintsByUsername[username]; !exists {
+				hintsByUsername[username] = hint
+			}
+		}
+
+		for _, hash := range hashlistHashes {
+			hint, ok := hintsByUsername[hash.Username]
+			if hash.IsCracked || !ok {
+				continue
+			}
+			hashes = append(hashes, hash.NormalizedHash)
+			hints = append(hints, hint)
+		}
+	} else {
+		for i, hash := range hashlistHashes {
+			if i >= len(lines) {
+				break
+			}
+			if hash.IsCracked {
+				continue
+			}
+			hashes = append(hashes, hash.NormalizedHash)
+			hints = append(hints, lines[i])
+		}
+	}
+
+	if len(hashes) == 0 {
+		return nil, nil, errNoAssociatedHints
+	}
+
+	return hashes, hints, nil
+}
+
+// Association attacks are split up by handing each shard its own share of the hash/hint pairs
+func shardAssociationAttack(attack *db.Attack, targets []ShardTarget) ([]*db.Job, *db.Hashlist, error) {
+	params := attack.HashcatParams.Data()
+	if len(params.WordlistFilenames) != 1 {
+		return nil, nil, fmt.Errorf("expected 1 hint wordlist for association attack, but %d given", len(params.WordlistFilenames))
+	}
+
+	hashlist, err := db.GetHashlistWithHashes(attack.HashlistID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes, hints, err := getAssociationPairs(hashlist, params.WordlistFilenames[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(targets) == 0 {
+		// Nobody to size shards for, just make the one job
+		targets = []ShardTarget{{Weight: 1}}
+	}
+
+	boundaries := splitByWeights(int64(len(hashes)), shardWeights(targets))
+	jobs := []*db.Job{}
+
+	err = db.GetInstance().Transaction(func(tx *gorm.DB) error {
+		for i, target := range targets {
+			if boundaries[i] == boundaries[i+1] {
+				// More shards than hashes to go around
+				continue
+			}
+
+			var preferredAgentID *uuid.UUID
+			if target.AgentID != uuid.Nil {
+				preferredAgentID = &target.AgentID
+			}
+
+			dbJob, err := db.CreateJobTx(&db.Job{
+				HashlistVersion:  hashlist.Version,
+				AttackID:         &attack.ID,
+				HashcatParams:    attack.HashcatParams,
+				TargetHashes:     hashes[boundaries[i]:boundaries[i+1]],
+				AssociatedHints:  hints[boundaries[i]:boundaries[i+1]],
+				HashType:         hashlist.HashType,
+				PreferredAgentID: preferredAgentID,
+			}, tx)
+
+			jobs = append(jobs, dbJob)
+
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jobs, hashlist, nil
+}
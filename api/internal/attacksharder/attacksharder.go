@@ -4,8 +4,15 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/api/internal/config"
 	"github.com/lachlan2k/phatcrack/api/internal/db"
 	"github.com/lachlan2k/phatcrack/api/internal/hashcathelpers"
 	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
@@ -29,45 +36,187 @@ var builtinCharset = map[byte][]byte{
 	'b': {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115, 116, 117, 118, 119, 120, 121, 122, 123, 124, 125, 126, 127, 128, 129, 130, 131, 132, 133, 134, 135, 136, 137, 138, 139, 140, 141, 142, 143, 144, 145, 146, 147, 148, 149, 150, 151, 152, 153, 154, 155, 156, 157, 158, 159, 160, 161, 162, 163, 164, 165, 166, 167, 168, 169, 170, 171, 172, 173, 174, 175, 176, 177, 178, 179, 180, 181, 182, 183, 184, 185, 186, 187, 188, 189, 190, 191, 192, 193, 194, 195, 196, 197, 198, 199, 200, 201, 202, 203, 204, 205, 206, 207, 208, 209, 210, 211, 212, 213, 214, 215, 216, 217, 218, 219, 220, 221, 222, 223, 224, 225, 226, 227, 228, 229, 230, 231, 232, 233, 234, 235, 236, 237, 238, 239, 240, 241, 242, 243, 244, 245, 246, 247, 248, 249, 250, 251, 252, 253, 254, 255},
 }
 
-func splitMask(inputMask string, numChunks int) (outputMask string, outputCharsets [][]byte, err error) {
-	firstVariableIndex := -1
-	for i := range inputMask {
+// Splits [0, total) into len(weights) contiguous pieces, each sized in proportion to its weight
+// Piece i is [boundaries[i], boundaries[i+1]). Every piece gets at least one element, if there are enough to go around
+func splitByWeights(total int64, weights []float64) (boundaries []int64) {
+	n := len(weights)
+	boundaries = make([]int64, n+1)
+	if n == 0 {
+		return
+	}
+
+	weightSum := 0.0
+	for _, w := range weights {
+		weightSum += w
+	}
+
+	cumulative := 0.0
+	for i := 1; i < n; i++ {
+		if weightSum > 0 {
+			cumulative += weights[i-1]
+			boundaries[i] = int64(math.Round(float64(total) * cumulative / weightSum))
+		} else {
+			boundaries[i] = total * int64(i) / int64(n)
+		}
+
+		// Don't let rounding starve a shard, or let one shard eat everyone else's share
+		boundaries[i] = max(boundaries[i], boundaries[i-1]+1)
+		boundaries[i] = min(boundaries[i], total-int64(n-i))
+		boundaries[i] = max(boundaries[i], boundaries[i-1])
+	}
+	boundaries[n] = total
+
+	return
+}
+
+var errMaskTooSmall = errors.New("mask doesn't have enough variable positions to go around")
+
+// A single position in a mask, either a literal character or a variable that can take any value from charset
+type maskToken struct {
+	text    string
+	charset []byte
+}
+
+func (t maskToken) isVariable() bool {
+	return t.charset != nil
+}
+
+func parseMask(inputMask string, customCharsets []string) ([]maskToken, error) {
+	tokens := []maskToken{}
+
+	for i := 0; i < len(inputMask); i++ {
 		if inputMask[i] != '?' {
+			tokens = append(tokens, maskToken{text: inputMask[i : i+1]})
 			continue
 		}
 
 		if i == len(inputMask)-1 {
-			return "", nil, fmt.Errorf("'%q' is not a valid mask (unexpected ? at end)", inputMask)
+			return nil, fmt.Errorf("'%q' is not a valid mask (unexpected ? at end)", inputMask)
+		}
+
+		i++
+		maskChar := inputMask[i]
+		text := inputMask[i-1 : i+1]
+
+		if maskChar == '?' {
+			// Escaped literal ?
+			tokens = append(tokens, maskToken{text: text})
+			continue
+		}
+
+		if charset, ok := builtinCharset[maskChar]; ok {
+			tokens = append(tokens, maskToken{text: text, charset: charset})
+			continue
+		}
+
+		customIndex := int(maskChar - '1')
+		if maskChar < '1' || maskChar > '3' || customIndex >= len(customCharsets) {
+			return nil, fmt.Errorf("the variable %q in the mask '%q' was not recognized", text, inputMask)
+		}
+
+		// Custom charsets are stored hex-encoded, so we can pass any bytes through to hashcat
+		customCharset, err := hex.DecodeString(customCharsets[customIndex])
+		if err != nil {
+			return nil, fmt.Errorf("custom charset %d is not valid hex: %w", customIndex+1, err)
+		}
+
+		charset := []byte{}
+		for _, c := range customCharset {
+			if !slices.Contains(charset, c) {
+				charset = append(charset, c)
+			}
+		}
+		if len(charset) == 0 {
+			return nil, fmt.Errorf("custom charset %d is empty", customIndex+1)
 		}
 
-		firstVariableIndex = i
-		break
+		tokens = append(tokens, maskToken{text: text, charset: charset})
 	}
 
-	// While a mask with no variables in it is dumb, its not *technically* wrong
-	// But I'm going to throw a fit regardless
-	if firstVariableIndex == -1 {
-		return "", nil, fmt.Errorf("'%q' cannot be chunked as it contains no variables", inputMask)
+	return tokens, nil
+}
+
+// One shard of a mask: some leading variables are pinned to a single character, and one variable is narrowed down to part of its charset
+type maskShard struct {
+	fixed        map[int]byte
+	shardPos     int
+	shardCharset []byte
+}
+
+// Splits the mask between shards with the given weights, looking at variables before position limit
+// If there are more shards than characters in a variable, each character is pinned and handed to a group of shards, which split the next variable between them
+func planMaskShards(tokens []maskToken, from int, limit int, weights []float64, fixed map[int]byte) ([]maskShard, error) {
+	pos := from
+	for pos < limit && !tokens[pos].isVariable() {
+		pos++
+	}
+	if pos >= limit {
+		return nil, errMaskTooSmall
 	}
 
-	maskChar := inputMask[firstVariableIndex+1]
-	builtinCharset, ok := builtinCharset[maskChar]
-	if !ok {
-		return "", nil, fmt.Errorf("the first variable in the mask '%q' was not recognized", inputMask)
+	charset := tokens[pos].charset
+
+	if len(weights) <= len(charset) {
+		shards := []maskShard{}
+		boundaries := splitByWeights(int64(len(charset)), weights)
+		for i := range weights {
+			shards = append(shards, maskShard{
+				fixed:        fixed,
+				shardPos:     pos,
+				shardCharset: charset[boundaries[i]:boundaries[i+1]],
+			})
+		}
+		return shards, nil
 	}
 
-	// Use ?4 as the "magic" custom charset dedicated to sharding
-	outputMask = inputMask[:firstVariableIndex+1] + "4" + inputMask[firstVariableIndex+2:]
-	outputCharsets = [][]byte{}
+	groupWeights := make([]float64, len(charset))
+	for i := range groupWeights {
+		groupWeights[i] = 1
+	}
 
-	for i := 0; i < numChunks; i++ {
-		start := (i * len(builtinCharset) / numChunks)
-		end := ((i + 1) * len(builtinCharset)) / numChunks
+	shards := []maskShard{}
+	groupBoundaries := splitByWeights(int64(len(weights)), groupWeights)
+	for i, c := range charset {
+		groupFixed := maps.Clone(fixed)
+		if groupFixed == nil {
+			groupFixed = map[int]byte{}
+		}
+		groupFixed[pos] = c
 
-		outputCharsets = append(outputCharsets, builtinCharset[start:end])
+		groupShards, err := planMaskShards(tokens, pos+1, limit, weights[groupBoundaries[i]:groupBoundaries[i+1]], groupFixed)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, groupShards...)
 	}
 
-	return outputMask, outputCharsets, nil
+	return shards, nil
+}
+
+// Builds the mask for a shard, using ?4 as the "magic" custom charset dedicated to sharding
+func (shard maskShard) mask(tokens []maskToken) (string, error) {
+	mask := ""
+	for i, token := range tokens {
+		c, isFixed := shard.fixed[i]
+
+		switch {
+		case i == shard.shardPos:
+			mask += "?4"
+
+		case isFixed && c == '?':
+			mask += "??"
+
+		case isFixed:
+			if c < ' ' || c > '~' {
+				return "", fmt.Errorf("can't pin the byte 0x%02x in a mask", c)
+			}
+			mask += string(c)
+
+		default:
+			mask += token.text
+		}
+	}
+	return mask, nil
 }
 
 func createSingleJobfromAttack(attack *db.Attack) (*db.Job, *db.Hashlist, error) {
@@ -98,40 +247,79 @@ func createSingleJobfromAttack(attack *db.Attack) (*db.Job, *db.Hashlist, error)
 	return dbJob, hashlist, err
 }
 
-func shardMaskAttack(attack *db.Attack, numJobs int) ([]*db.Job, *db.Hashlist, error) {
+func shardMaskAttack(attack *db.Attack, targets []ShardTarget) ([]*db.Job, *db.Hashlist, error) {
 	params := attack.HashcatParams.Data()
 	if len(params.MaskCustomCharsets) >= 4 {
 		return nil, nil, fmt.Errorf("received %d custom character sets, maximum is 3", len(params.MaskCustomCharsets))
 	}
 
-	outputMask, shardedCharsets, err := splitMask(params.Mask, numJobs)
+	tokens, err := parseMask(params.Mask, params.MaskCustomCharsets)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	hashlist, err := db.GetHashlistWithHashes(attack.HashlistID.String())
-	if err != nil {
-		return nil, nil, err
+	// With --increment, only the positions hashcat actually gets up to are any use for sharding
+	limit := len(tokens)
+	minLength := 1
+	if params.MaskIncrement {
+		if params.MaskIncrementMax > 0 && int(params.MaskIncrementMax) < limit {
+			limit = int(params.MaskIncrementMax)
+		}
+		if params.MaskIncrementMin > 0 {
+			minLength = int(params.MaskIncrementMin)
+		}
 	}
 
-	targetHashes := []string{}
-	for _, hash := range hashlist.Hashes {
-		if !hash.IsCracked {
-			targetHashes = append(targetHashes, hash.NormalizedHash)
+	shards, err := planMaskShards(tokens, 0, limit, shardWeights(targets), nil)
+	masks := make([]string, len(shards))
+	if err == nil {
+		for i, shard := range shards {
+			masks[i], err = shard.mask(tokens)
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		if params.MaskIncrement {
+			// Hashcat doesn't support --skip/--limit with --increment, so all we can do is run it as one job
+			logrus.WithError(err).WithField("attack_id", attack.ID.String()).Warn("Couldn't shard incrementing mask attack, running it as a single job")
+			job, hashlist, err := createSingleJobfromAttack(attack)
+			if err != nil {
+				return nil, nil, err
+			}
+			return []*db.Job{job}, hashlist, nil
 		}
+
+		logrus.WithError(err).WithField("attack_id", attack.ID.String()).Info("Couldn't shard mask attack by charset, falling back to sharding by keyspace")
+		return shardAttackByKeyspace(attack, targets)
 	}
 
-	params.Mask = outputMask
+	// Every shard needs to be long enough to reach its sharded position
+	shardedLength := 0
+	for _, shard := range shards {
+		shardedLength = max(shardedLength, shard.shardPos+1)
+	}
+
+	hashlist, err := db.GetHashlistWithHashes(attack.HashlistID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetHashes := getUncrackedHashes(hashlist)
 	jobs := []*db.Job{}
 
 	err = db.GetInstance().Transaction(func(tx *gorm.DB) error {
-		for i := 0; i < numJobs; i++ {
-			params.MaskShardedCharset = hex.EncodeToString(shardedCharsets[i])
+		if params.MaskIncrement && minLength < shardedLength {
+			// The lengths that are too short to be sharded get done once, as their own job
+			shortParams := params
+			shortParams.MaskIncrementMax = uint(shardedLength - 1)
 
 			dbJob, err := db.CreateJobTx(&db.Job{
 				HashlistVersion: hashlist.Version,
 				AttackID:        &attack.ID,
-				HashcatParams:   datatypes.NewJSONType(params),
+				HashcatParams:   datatypes.NewJSONType(shortParams),
 				TargetHashes:    targetHashes,
 				HashType:        hashlist.HashType,
 			}, tx)
@@ -142,6 +330,35 @@ func shardMaskAttack(attack *db.Attack, numJobs int) ([]*db.Job, *db.Hashlist, e
 				return err
 			}
 		}
+
+		for i, target := range targets {
+			if len(shards[i].shardCharset) == 0 {
+				// More shards than characters to go around
+				continue
+			}
+
+			shardParams := params
+			shardParams.Mask = masks[i]
+			shardParams.MaskShardedCharset = hex.EncodeToString(shards[i].shardCharset)
+			if params.MaskIncrement {
+				shardParams.MaskIncrementMin = uint(max(minLength, shardedLength))
+			}
+
+			dbJob, err := db.CreateJobTx(&db.Job{
+				HashlistVersion:  hashlist.Version,
+				AttackID:         &attack.ID,
+				HashcatParams:    datatypes.NewJSONType(shardParams),
+				TargetHashes:     targetHashes,
+				HashType:         hashlist.HashType,
+				PreferredAgentID: &target.AgentID,
+			}, tx)
+
+			jobs = append(jobs, dbJob)
+
+			if err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 	if err != nil {
@@ -183,7 +400,7 @@ func getKeyspace(params hashcattypes.HashcatParams) (int64, error) {
 	return keyspace, nil
 }
 
-func shardAttackByKeyspace(attack *db.Attack, numJobs int) ([]*db.Job, *db.Hashlist, error) {
+func shardAttackByKeyspace(attack *db.Attack, targets []ShardTarget) ([]*db.Job, *db.Hashlist, error) {
 	params := attack.HashcatParams.Data()
 	hashlist, err := db.GetHashlistWithHashes(attack.HashlistID.String())
 	if err != nil {
@@ -202,25 +419,31 @@ func shardAttackByKeyspace(attack *db.Attack, numJobs int) ([]*db.Job, *db.Hashl
 		return nil, nil, fmt.Errorf("couldn't calculate keyspace for sharding: %w", err)
 	}
 
-	limitPerJob := keyspace / int64(numJobs)
+	boundaries := splitByWeights(keyspace, shardWeights(targets))
 	jobs := []*db.Job{}
 
 	err = db.GetInstance().Transaction(func(tx *gorm.DB) error {
-		for i := 0; i < numJobs; i++ {
-			params.Skip = limitPerJob * int64(i)
+		for i, target := range targets {
+			if boundaries[i] == boundaries[i+1] {
+				// More shards than keyspace to go around
+				continue
+			}
 
-			if i == numJobs-1 {
+			params.Skip = boundaries[i]
+
+			if i == len(targets)-1 {
 				params.Limit = 0
 			} else {
-				params.Limit = limitPerJob
+				params.Limit = boundaries[i+1] - boundaries[i]
 			}
 
 			dbJob, err := db.CreateJobTx(&db.Job{
-				HashlistVersion: hashlist.Version,
-				AttackID:        &attack.ID,
-				HashcatParams:   datatypes.NewJSONType(params),
-				TargetHashes:    targetHashes,
-				HashType:        hashlist.HashType,
+				HashlistVersion:  hashlist.Version,
+				AttackID:         &attack.ID,
+				HashcatParams:    datatypes.NewJSONType(params),
+				TargetHashes:     targetHashes,
+				HashType:         hashlist.HashType,
+				PreferredAgentID: &target.AgentID,
 			}, tx)
 
 			jobs = append(jobs, dbJob)
@@ -238,8 +461,195 @@ func shardAttackByKeyspace(attack *db.Attack, numJobs int) ([]*db.Job, *db.Hashl
 	return jobs, hashlist, nil
 }
 
-func MakeJobs(attack *db.Attack, maxNumJobs int) ([]*db.Job, *db.Hashlist, error) {
-	if !attack.IsDistributed || maxNumJobs <= 1 {
+// How far back we'll look for hashrate measurements when sizing shards
+const hashrateLookback = 7 * 24 * time.Hour
+
+// A shard of an attack we intend to give to a particular agent, sized relative to the other shards by Weight
+type ShardTarget struct {
+	AgentID uuid.UUID
+	Weight  float64
+
+	// Whether Weight is the agent's measured or benchmarked hashrate, rather than a stand-in because we know nothing about its speed
+	IsMeasured bool
+}
+
+func shardWeights(targets []ShardTarget) []float64 {
+	weights := make([]float64, len(targets))
+	for i, target := range targets {
+		weights[i] = target.Weight
+	}
+	return weights
+}
+
+// Plans out jobsPerAgent shards for every schedulable agent the constraints allow, weighted by how fast that agent has recently been at the hash type (or benchmarked at)
+// Agents we have no measurements for are assumed to be average, and if we know nothing at all, every shard is equal
+func PlanShards(hashType uint, jobsPerAgent int, constraints db.AgentConstraints) ([]ShardTarget, error) {
+	agents, err := db.GetAllSchedulableAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	// No point cutting shards for agents that won't ever be given them
+	agents = slices.DeleteFunc(agents, func(agent db.Agent) bool {
+		return !constraints.Allows(agent)
+	})
+
+	hashrates, err := db.GetRecentAgentHashrates(int(hashType), time.Now().Add(-hashrateLookback))
+	if err != nil {
+		return nil, err
+	}
+
+	// Speeds from real jobs are preferred, but a benchmark is better than nothing
+	for _, agent := range agents {
+		if _, ok := hashrates[agent.ID.String()]; ok {
+			continue
+		}
+		if hashrate, ok := agent.BenchmarkedHashrate(hashType); ok {
+			hashrates[agent.ID.String()] = hashrate
+		}
+	}
+
+	averageHashrate := 1.0
+	numMeasured := 0
+	hashrateSum := 0.0
+	for _, agent := range agents {
+		if hashrate, ok := hashrates[agent.ID.String()]; ok {
+			hashrateSum += float64(hashrate)
+			numMeasured++
+		}
+	}
+	if numMeasured > 0 {
+		averageHashrate = hashrateSum / float64(numMeasured)
+	}
+
+	targets := []ShardTarget{}
+	for _, agent := range agents {
+		weight := averageHashrate
+		hashrate, isMeasured := hashrates[agent.ID.String()]
+		if isMeasured {
+			weight = float64(hashrate)
+		}
+
+		for i := 0; i < jobsPerAgent; i++ {
+			targets = append(targets, ShardTarget{
+				AgentID:    agent.ID,
+				Weight:     weight,
+				IsMeasured: isMeasured,
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+func getUncrackedHashes(hashlist *db.Hashlist) []string {
+	targetHashes := []string{}
+	for _, hash := range hashlist.Hashes {
+		if !hash.IsCracked {
+			targetHashes = append(targetHashes, hash.NormalizedHash)
+		}
+	}
+	return targetHashes
+}
+
+// Rather than splitting the whole keyspace up front, chunked attacks are carved into lots of small skip/limit chunks
+// Each target gets a chunk to begin with, and the dispatcher hands out the rest as agents finish (see MakeNextChunkJob)
+func startChunkedAttack(attack *db.Attack, targets []ShardTarget, chunksPerAgent int) ([]*db.Job, *db.Hashlist, error) {
+	keyspace, err := getKeyspace(attack.HashcatParams.Data())
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't calculate keyspace for chunking: %w", err)
+	}
+
+	agents := map[uuid.UUID]bool{}
+	for _, target := range targets {
+		agents[target.AgentID] = true
+	}
+
+	numChunks := int64(len(agents) * chunksPerAgent)
+	chunkSize := max(1, (keyspace+numChunks-1)/numChunks)
+
+	err = db.StartAttackChunking(attack.ID.String(), keyspace, chunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hashlist *db.Hashlist
+	jobs := []*db.Job{}
+	for _, target := range targets {
+		job, h, err := MakeNextChunkJob(attack, &target.AgentID)
+		if err != nil {
+			// The attack won't be started, so it mustn't be left with chunks to hand out, or jobs that will never run
+			stopErr := db.StopAttackChunking(attack.ID.String())
+			if stopErr != nil {
+				logrus.WithError(stopErr).WithField("attack_id", attack.ID.String()).Error("Failed to stop chunking attack that couldn't be started")
+			}
+			for _, job := range jobs {
+				db.HardDelete(job)
+			}
+			return nil, nil, err
+		}
+		if job == nil {
+			// Ran out of keyspace before everyone got a chunk
+			break
+		}
+
+		hashlist = h
+		jobs = append(jobs, job)
+	}
+
+	return jobs, hashlist, nil
+}
+
+// Creates a job for the next unclaimed chunk of a chunked attack, or returns a nil job if there's nothing left to do
+func MakeNextChunkJob(attack *db.Attack, preferredAgentID *uuid.UUID) (*db.Job, *db.Hashlist, error) {
+	hashlist, err := db.GetHashlistWithHashes(attack.HashlistID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetHashes := getUncrackedHashes(hashlist)
+	if len(targetHashes) == 0 {
+		// Everything has been cracked already, no point handing out the rest
+		return nil, hashlist, db.StopAttackChunking(attack.ID.String())
+	}
+
+	skip, limit, ok, err := db.ClaimNextAttackChunk(attack.ID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, hashlist, nil
+	}
+
+	params := attack.HashcatParams.Data()
+	params.Skip = skip
+	params.Limit = limit
+
+	job, err := db.CreateJob(&db.Job{
+		HashlistVersion:  hashlist.Version,
+		AttackID:         &attack.ID,
+		HashcatParams:    datatypes.NewJSONType(params),
+		TargetHashes:     targetHashes,
+		HashType:         hashlist.HashType,
+		PreferredAgentID: preferredAgentID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return job, hashlist, nil
+}
+
+func MakeJobs(attack *db.Attack, targets []ShardTarget) ([]*db.Job, *db.Hashlist, error) {
+	if attack.HashcatParams.Data().AttackMode == hashcattypes.AttackModeAssociation {
+		// Even a single job needs its hashes paired up with hints
+		if !attack.IsDistributed {
+			targets = nil
+		}
+		return shardAssociationAttack(attack, targets)
+	}
+
+	if !attack.IsDistributed || len(targets) <= 1 {
 		job, h, err := createSingleJobfromAttack(attack)
 		if err != nil {
 			return nil, nil, err
@@ -248,12 +658,24 @@ func MakeJobs(attack *db.Attack, maxNumJobs int) ([]*db.Job, *db.Hashlist, error
 		return jobs, h, err
 	}
 
-	switch attack.HashcatParams.Data().AttackMode {
+	params := attack.HashcatParams.Data()
+
+	// Anything with a keyspace can be chunked, which is only ruled out by --increment
+	chunksPerAgent := config.Get().Agent.ChunksPerAgent
+	canChunk := chunksPerAgent > 0 && !params.MaskIncrement
+
+	switch params.AttackMode {
 	case hashcattypes.AttackModeDictionary, hashcattypes.AttackModeCombinator:
-		return shardAttackByKeyspace(attack, maxNumJobs)
+		if canChunk {
+			return startChunkedAttack(attack, targets, chunksPerAgent)
+		}
+		return shardAttackByKeyspace(attack, targets)
 
 	case hashcattypes.AttackModeMask, hashcattypes.AttackModeHybridDM, hashcattypes.AttackModeHybridMD:
-		return shardMaskAttack(attack, maxNumJobs)
+		if canChunk {
+			return startChunkedAttack(attack, targets, chunksPerAgent)
+		}
+		return shardMaskAttack(attack, targets)
 
 	default:
 		return nil, nil, fmt.Errorf("unrecognized attack mode: %d", attack.HashcatParams.Data().AttackMode)
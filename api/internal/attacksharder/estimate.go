@@ -0,0 +1,220 @@
+package attacksharder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+)
+
+// Returned when the way an attack is set up means we can't work out its keyspace ahead of time
+var ErrCantEstimate = errors.New("attack can't be estimated")
+
+// How much of an attack we expect one agent to get, and how long it would take them
+type ShardEstimate struct {
+	// uuid.Nil if the attack isn't distributed, as whichever agent is free will pick it up
+	AgentID    uuid.UUID
+	Keyspace   int64
+	Candidates float64
+	Hashrate   float64
+	IsMeasured bool
+}
+
+type Estimate struct {
+	Keyspace   int64
+	Candidates float64
+	Shards     []ShardEstimate
+
+	// Combined hashrate of every agent that would be working on the attack
+	Hashrate float64
+
+	// Only set if we've seen at least one of the agents run (or benchmark) the hash type recently
+	HasEstimate      bool
+	EstimatedSeconds float64
+}
+
+func (e *Estimate) ToDTO() apitypes.AttackEstimateResponseDTO {
+	shards := make([]apitypes.AttackEstimateShardDTO, len(e.Shards))
+	for i, shard := range e.Shards {
+		agentId := ""
+		if shard.AgentID != uuid.Nil {
+			agentId = shard.AgentID.String()
+		}
+
+		shards[i] = apitypes.AttackEstimateShardDTO{
+			AgentID:    agentId,
+			Keyspace:   shard.Keyspace,
+			Candidates: shard.Candidates,
+			Hashrate:   shard.Hashrate,
+			IsMeasured: shard.IsMeasured,
+		}
+		if e.HasEstimate && shard.Hashrate > 0 {
+			shards[i].EstimatedSeconds = shard.Candidates / shard.Hashrate
+		}
+	}
+
+	return apitypes.AttackEstimateResponseDTO{
+		Keyspace:         e.Keyspace,
+		Candidates:       e.Candidates,
+		Shards:           shards,
+		Hashrate:         e.Hashrate,
+		HasEstimate:      e.HasEstimate,
+		EstimatedSeconds: e.EstimatedSeconds,
+	}
+}
+
+func listfileLines(listfileId string) (float64, error) {
+	listfile, err := db.GetListfile(listfileId)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't fetch listfile %q: %w", listfileId, err)
+	}
+	return float64(listfile.Lines), nil
+}
+
+func maskCandidates(params hashcattypes.HashcatParams) (float64, error) {
+	tokens, err := parseMask(params.Mask, params.MaskCustomCharsets)
+	if err != nil {
+		return 0, err
+	}
+
+	candidates := 1.0
+	for _, token := range tokens {
+		if token.isVariable() {
+			candidates *= float64(len(token.charset))
+		}
+	}
+	return candidates, nil
+}
+
+// Hashcat's keyspace only counts the base loop that --skip and --limit work on, so this works out how many candidates are actually tried
+// Floats, as a big enough mask will happily overflow an int64
+func countCandidates(params hashcattypes.HashcatParams, keyspace int64) (float64, error) {
+	switch params.AttackMode {
+	case hashcattypes.AttackModeDictionary:
+		candidates := float64(keyspace)
+		for _, rulefileId := range params.RulesFilenames {
+			// Comments and blank lines are counted as rules, but it's close enough
+			lines, err := listfileLines(rulefileId)
+			if err != nil {
+				return 0, err
+			}
+			candidates *= max(lines, 1)
+		}
+		return candidates, nil
+
+	case hashcattypes.AttackModeCombinator:
+		rightLines, err := listfileLines(params.WordlistFilenames[1])
+		if err != nil {
+			return 0, err
+		}
+		return float64(keyspace) * rightLines, nil
+
+	case hashcattypes.AttackModeMask:
+		return maskCandidates(params)
+
+	case hashcattypes.AttackModeHybridDM, hashcattypes.AttackModeHybridMD:
+		wordlistLines, err := listfileLines(params.WordlistFilenames[0])
+		if err != nil {
+			return 0, err
+		}
+		maskSize, err := maskCandidates(params)
+		if err != nil {
+			return 0, err
+		}
+		return wordlistLines * maskSize, nil
+
+	default:
+		return 0, fmt.Errorf("%w: attack mode %d isn't supported", ErrCantEstimate, params.AttackMode)
+	}
+}
+
+// Works out how big the attack is, how it would be split up across the fleet as it is now, and how long it would take
+// Speeds come from the last measurement or benchmark of each agent on the hash type, so this is only as good as that history
+// Only agents the constraints allow are considered
+func EstimateAttack(params hashcattypes.HashcatParams, isDistributed bool, constraints db.AgentConstraints) (*Estimate, error) {
+	if params.AttackMode == hashcattypes.AttackModeAssociation {
+		return nil, fmt.Errorf("%w: association attacks depend on the hints for each hash", ErrCantEstimate)
+	}
+	if params.MaskIncrement {
+		return nil, fmt.Errorf("%w: masks using increment don't have a single keyspace", ErrCantEstimate)
+	}
+
+	keyspace, err := getKeyspace(params)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't calculate keyspace for estimate: %w", err)
+	}
+
+	candidates, err := countCandidates(params, keyspace)
+	if err != nil {
+		return nil, err
+	}
+
+	candidatesPerKeyspace := 0.0
+	if keyspace > 0 {
+		candidatesPerKeyspace = candidates / float64(keyspace)
+	}
+
+	targets, err := PlanShards(params.HashType, 1, constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &Estimate{
+		Keyspace:   keyspace,
+		Candidates: candidates,
+	}
+
+	// Unmeasured agents are weighted as if they were average, which is only worth anything if someone was measured
+	for _, target := range targets {
+		estimate.HasEstimate = estimate.HasEstimate || target.IsMeasured
+	}
+
+	if !isDistributed || len(targets) <= 1 {
+		// One job, for whichever agent gets to it first, so assume an average one
+		shard := ShardEstimate{
+			Keyspace:   keyspace,
+			Candidates: candidates,
+			IsMeasured: estimate.HasEstimate,
+		}
+		if estimate.HasEstimate {
+			for _, target := range targets {
+				shard.Hashrate += target.Weight
+			}
+			shard.Hashrate /= float64(len(targets))
+		}
+
+		estimate.Shards = []ShardEstimate{shard}
+		estimate.Hashrate = shard.Hashrate
+		if shard.Hashrate > 0 {
+			estimate.EstimatedSeconds = candidates / shard.Hashrate
+		}
+		return estimate, nil
+	}
+
+	boundaries := splitByWeights(keyspace, shardWeights(targets))
+	for i, target := range targets {
+		shard := ShardEstimate{
+			AgentID:    target.AgentID,
+			Keyspace:   boundaries[i+1] - boundaries[i],
+			IsMeasured: target.IsMeasured,
+		}
+		shard.Candidates = float64(shard.Keyspace) * candidatesPerKeyspace
+
+		if estimate.HasEstimate {
+			shard.Hashrate = target.Weight
+			estimate.Hashrate += target.Weight
+
+			// Every agent has to finish its shard, so the slowest one decides when the attack is done
+			if shard.Hashrate > 0 {
+				estimate.EstimatedSeconds = max(estimate.EstimatedSeconds, shard.Candidates/shard.Hashrate)
+			}
+		}
+
+		estimate.Shards = append(estimate.Shards, shard)
+	}
+
+	return estimate, nil
+}
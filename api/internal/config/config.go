@@ -45,6 +45,8 @@ type AuthConfig struct {
 type AgentConfig struct {
 	AutomaticallySyncListfiles bool `json:"auto_sync_listfiles"`
 	SplitJobsPerAgent          int  `json:"split_jobs_per_agent"`
+	// When non-zero, distributed attacks that can be split by keyspace are carved into this many chunks per agent, and handed out as agents free up
+	ChunksPerAgent int `json:"chunks_per_agent"`
 }
 
 type GeneralConfig struct {
@@ -99,6 +101,7 @@ func (conf RuntimeConfig) ToAdminDTO() apitypes.AdminConfigResponseDTO {
 		Agent: apitypes.AgentConfigDTO{
 			AutomaticallySyncListfiles: conf.Agent.AutomaticallySyncListfiles,
 			SplitJobsPerAgent:          conf.Agent.SplitJobsPerAgent,
+			ChunksPerAgent:             conf.Agent.ChunksPerAgent,
 		},
 
 		General: apitypes.GeneralConfigDTO{
@@ -152,6 +155,7 @@ func MakeDefaultConfig() RuntimeConfig {
 		Agent: AgentConfig{
 			AutomaticallySyncListfiles: true,
 			SplitJobsPerAgent:          1,
+			ChunksPerAgent:             4,
 		},
 
 		General: GeneralConfig{
@@ -40,6 +40,7 @@ func migrateV1ToV2(oldConfig v1runtimeConfig) RuntimeConfig {
 		Agent: AgentConfig{
 			AutomaticallySyncListfiles: oldConfig.AutomaticallySyncListfiles,
 			SplitJobsPerAgent:          oldConfig.SplitJobsPerAgent,
+			ChunksPerAgent:             4,
 		},
 
 		General: GeneralConfig{
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/lachlan2k/phatcrack/api/internal/auth"
 	"github.com/lachlan2k/phatcrack/api/internal/config"
 	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/fleet"
 	"github.com/lachlan2k/phatcrack/api/internal/roles"
 	"github.com/lachlan2k/phatcrack/api/internal/util"
 	"github.com/lachlan2k/phatcrack/api/internal/version"
@@ -54,6 +56,7 @@ func HookAdminEndpoints(api *echo.Group) {
 
 				newConf.Agent.AutomaticallySyncListfiles = a.AutomaticallySyncListfiles
 				newConf.Agent.SplitJobsPerAgent = a.SplitJobsPerAgent
+				newConf.Agent.ChunksPerAgent = a.ChunksPerAgent
 			}
 
 			if req.Auth != nil {
@@ -138,11 +141,174 @@ func HookAdminEndpoints(api *echo.Group) {
 
 		return c.JSON(http.StatusOK, "ok")
 	})
+	api.POST("/agent/:id/drain", func(c echo.Context) error {
+		id := c.Param("id")
+		if !util.AreValidUUIDs(id) {
+			return echo.ErrBadRequest
+		}
+
+		req, err := util.BindAndValidate[apitypes.AdminAgentDrainRequestDTO](c)
+		if err != nil {
+			return err
+		}
+
+		err = fleet.DrainAgent(id, req.MigrateRunningJobs)
+		if err != nil {
+			return util.ServerError("Failed to drain agent", err)
+		}
+
+		AuditLog(c, log.Fields{
+			"agent_id":             id,
+			"migrate_running_jobs": req.MigrateRunningJobs,
+		}, "Admin started draining agent")
+
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	api.POST("/agent/:id/undrain", func(c echo.Context) error {
+		id := c.Param("id")
+		if !util.AreValidUUIDs(id) {
+			return echo.ErrBadRequest
+		}
+
+		err := fleet.UndrainAgent(id)
+		if err != nil {
+			return util.ServerError("Failed to stop draining agent", err)
+		}
+
+		AuditLog(c, log.Fields{
+			"agent_id": id,
+		}, "Admin stopped draining agent")
+
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	api.PUT("/agent/:id/set-max-concurrent-jobs", func(c echo.Context) error {
+		id := c.Param("id")
+		req, err := util.BindAndValidate[apitypes.AdminAgentSetMaxConcurrentJobsRequestDTO](c)
+		if err != nil {
+			return err
+		}
+
+		err = db.UpdateAgentMaxConcurrentJobs(id, req.MaxConcurrentJobs)
+		if err != nil {
+			return util.ServerError("Failed to set agent's max concurrent jobs", err)
+		}
+
+		AuditLog(c, log.Fields{
+			"agent_id":            id,
+			"max_concurrent_jobs": req.MaxConcurrentJobs,
+		}, "Admin set agent's max concurrent jobs")
+
+		// The agent may have more room now
+		fleet.QueueDispatch()
+
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	api.PUT("/agent/:id/set-thermal-policy", func(c echo.Context) error {
+		id := c.Param("id")
+		if !util.AreValidUUIDs(id) {
+			return echo.ErrBadRequest
+		}
+
+		req, err := util.BindAndValidate[apitypes.AdminAgentSetThermalPolicyRequestDTO](c)
+		if err != nil {
+			return err
+		}
+
+		err = fleet.SetAgentThermalPolicy(id, db.AgentThermalPolicy{
+			TempAbort: req.TempAbort,
+			MaxTemp:   req.MaxTemp,
+			Action:    req.Action,
+		})
+		if err != nil {
+			return util.ServerError("Failed to set agent's thermal policy", err)
+		}
+
+		AuditLog(c, log.Fields{
+			"agent_id":   id,
+			"temp_abort": req.TempAbort,
+			"max_temp":   req.MaxTemp,
+			"action":     req.Action,
+		}, "Admin set agent's thermal policy")
+
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	api.PUT("/agent/:id/set-labels", func(c echo.Context) error {
+		id := c.Param("id")
+		if !util.AreValidUUIDs(id) {
+			return echo.ErrBadRequest
+		}
+
+		req, err := util.BindAndValidate[apitypes.AdminAgentSetLabelsRequestDTO](c)
+		if err != nil {
+			return err
+		}
+
+		labels := []string{}
+		for _, label := range req.Labels {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+
+		err = db.UpdateAgentLabels(id, labels)
+		if err != nil {
+			return util.ServerError("Failed to set agent's labels", err)
+		}
+
+		AuditLog(c, log.Fields{
+			"agent_id": id,
+			"labels":   labels,
+		}, "Admin set agent's labels")
+
+		// Queued jobs might be allowed on the agent now
+		fleet.QueueDispatch()
+
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	api.POST("/agent/:id/benchmark", handleAgentBenchmark)
+
+	api.PUT("/attack/:id/set-priority", func(c echo.Context) error {
+		id := c.Param("id")
+		if !util.AreValidUUIDs(id) {
+			return echo.ErrBadRequest
+		}
+
+		req, err := util.BindAndValidate[apitypes.AdminAttackSetPriorityRequestDTO](c)
+		if err != nil {
+			return err
+		}
+
+		err = db.SetAttackPriority(id, req.Priority)
+		if err != nil {
+			return util.ServerError("Failed to set attack's priority", err)
+		}
+
+		AuditLog(c, log.Fields{
+			"attack_id": id,
+			"priority":  req.Priority,
+		}, "Admin set attack's priority")
+
+		fleet.QueueDispatch()
+
+		return c.JSON(http.StatusOK, "ok")
+	})
 
 	api.POST("/agent-registration-key/create", handleAgentRegistrationKeyCreate)
 	api.GET("/agent-registration-key/all", handleGetAllAgentRegistrationKeys)
 	api.DELETE("/agent-registration-key/:id", handleDeleteAgentRegistrationKey)
 
+	api.POST("/agent-pool/create", handleAgentPoolCreate)
+	api.GET("/agent-pool/all", handleGetAllAgentPools)
+	api.DELETE("/agent-pool/:id", handleDeleteAgentPool)
+	api.PUT("/agent/:id/set-agent-pool", handleSetAgentPool("agent", db.SetAgentAgentPool))
+	api.PUT("/project/:id/set-agent-pool", handleSetAgentPool("project", db.SetProjectAgentPool))
+	api.PUT("/user/:id/set-agent-pool", handleSetAgentPool("user", db.SetUserAgentPool))
+
 	api.PUT("/user/:id", handleUpdateUser)
 	api.PUT("/user/:id/password", handleUpdateUserPassword)
 
@@ -397,6 +563,47 @@ func handleDeleteAgent(c echo.Context) error {
 	return c.JSON(http.StatusOK, "ok")
 }
 
+func handleAgentBenchmark(c echo.Context) error {
+	id := c.Param("id")
+	if !util.AreValidUUIDs(id) {
+		return echo.ErrBadRequest
+	}
+
+	req, err := util.BindAndValidate[apitypes.AdminAgentBenchmarkRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	agent, err := db.GetAgent(id)
+	if err == db.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, "Agent does not exist")
+	}
+	if err != nil {
+		return util.ServerError("Failed to retrieve agent", err)
+	}
+
+	// The benchmark would be fighting the jobs for the devices, so neither would come out of it well
+	if len(agent.AgentInfo.Data().ActiveJobIDs) > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Agent is busy running jobs")
+	}
+
+	err = fleet.RequestBenchmark(id, req.HashTypes...)
+	if err == fleet.ErrAgentNotConnected {
+		return echo.NewHTTPError(http.StatusConflict, "Agent is not connected")
+	}
+	if err != nil {
+		return util.ServerError("Failed to request benchmark", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"agent_id":   id,
+		"agent_name": agent.Name,
+		"hash_types": req.HashTypes,
+	}, "Admin requested agent benchmark")
+
+	return c.JSON(http.StatusOK, "ok")
+}
+
 func handleUpdateUserPassword(c echo.Context) error {
 	req, err := util.BindAndValidate[apitypes.AdminUserUpdatePasswordRequestDTO](c)
 	if err != nil {
@@ -489,3 +696,102 @@ func handleDeleteAgentRegistrationKey(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, "ok")
 }
+
+func handleAgentPoolCreate(c echo.Context) error {
+	req, err := util.BindAndValidate[apitypes.AdminAgentPoolCreateRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	pool, err := db.CreateAgentPool(&db.AgentPool{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		return util.ServerError("Failed to create agent pool", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"agent_pool_id":   pool.ID.String(),
+		"agent_pool_name": pool.Name,
+	}, "New agent pool created")
+
+	return c.JSON(http.StatusCreated, pool.ToDTO())
+}
+
+func handleGetAllAgentPools(c echo.Context) error {
+	pools, err := db.GetAllAgentPools()
+	if err != nil {
+		return util.ServerError("Failed to get agent pools", err)
+	}
+
+	poolsDTO := make([]apitypes.AgentPoolDTO, len(pools))
+	for i, pool := range pools {
+		poolsDTO[i] = pool.ToDTO()
+	}
+
+	return c.JSON(http.StatusOK, apitypes.AdminGetAllAgentPoolsResponseDTO{
+		AgentPools: poolsDTO,
+	})
+}
+
+func handleDeleteAgentPool(c echo.Context) error {
+	id := c.Param("id")
+	if !util.AreValidUUIDs(id) {
+		return echo.ErrBadRequest
+	}
+
+	err := db.DeleteAgentPool(id)
+	if err != nil {
+		return util.ServerError("Failed to delete agent pool", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"agent_pool_id": id,
+	}, "Agent pool deleted")
+
+	// The pool's agents and work are part of the shared fleet again
+	fleet.QueueDispatch()
+
+	return c.JSON(http.StatusOK, "ok")
+}
+
+// Puts an agent, project or user (depending on what setPool does) into a pool, or takes it out of one
+func handleSetAgentPool(kind string, setPool func(id string, poolId string) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		if !util.AreValidUUIDs(id) {
+			return echo.ErrBadRequest
+		}
+
+		req, err := util.BindAndValidate[apitypes.AdminSetAgentPoolRequestDTO](c)
+		if err != nil {
+			return err
+		}
+
+		if req.AgentPoolID != "" {
+			_, err := db.GetAgentPool(req.AgentPoolID)
+			if err == db.ErrNotFound {
+				return echo.NewHTTPError(http.StatusBadRequest, "Agent pool doesn't exist")
+			}
+			if err != nil {
+				return util.ServerError("Failed to fetch agent pool", err)
+			}
+		}
+
+		err = setPool(id, req.AgentPoolID)
+		if err != nil {
+			return util.ServerError("Failed to set "+kind+"'s agent pool", err)
+		}
+
+		AuditLog(c, log.Fields{
+			kind + "_id":    id,
+			"agent_pool_id": req.AgentPoolID,
+		}, "Admin set %s's agent pool", kind)
+
+		// Queued jobs may be able to go somewhere new, or have to wait for somewhere else
+		fleet.QueueDispatch()
+
+		return c.JSON(http.StatusOK, "ok")
+	}
+}
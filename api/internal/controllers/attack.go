@@ -1,8 +1,7 @@
 package controllers
 
 import (
-	"encoding/hex"
-	"fmt"
+	"errors"
 	"net/http"
 	"time"
 
@@ -11,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/lachlan2k/phatcrack/api/internal/accesscontrol"
+	"github.com/lachlan2k/phatcrack/api/internal/attackhelpers"
 	"github.com/lachlan2k/phatcrack/api/internal/attacksharder"
 	"github.com/lachlan2k/phatcrack/api/internal/auth"
 	"github.com/lachlan2k/phatcrack/api/internal/config"
@@ -30,7 +30,13 @@ func HookAttackEndpoints(api *echo.Group) {
 	api.GET("/all-initialising", handleAttacksGetInitialising)
 	api.PUT("/:attack-id/start", handleAttackStart)
 	api.PUT("/:attack-id/restart-failed-jobs", handleAttackRestartFailedJobs)
+	api.PUT("/:attack-id/pause", handleAttackPause)
+	api.PUT("/:attack-id/resume", handleAttackResume)
+	api.PUT("/:attack-id/limits", handleAttackSetLimits)
+	api.PUT("/:attack-id/agent-placement", handleAttackSetAgentPlacement)
 	api.POST("/create", handleAttackCreate)
+	api.POST("/create-from-template", handleAttackCreateFromTemplate)
+	api.POST("/estimate", handleAttackEstimate)
 
 	api.DELETE("/:attack-id/stop", handleAttackStopAllJobs)
 	api.DELETE("/:attack-id", handleDeleteAttack)
@@ -187,14 +193,221 @@ func handleAttackStopAllJobs(c echo.Context) error {
 		return echo.ErrForbidden
 	}
 
-	jobs, err := db.GetJobsForAttack(attackId, false, false)
+	err = fleet.StopAttack(attackId, db.JobStopReasonUserStopped)
+	if err != nil {
+		return util.ServerError("Failed to stop attack", err)
+	}
+	return c.JSON(http.StatusOK, "ok")
+}
+
+func handleAttackPause(c echo.Context) error {
+	attackId := c.Param("attack-id")
+	if !util.AreValidUUIDs(attackId) {
+		return echo.ErrBadRequest
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	projId, err := db.GetAttackProjID(attackId)
+	if err != nil {
+		return util.ServerError("Failed to fetch project id for hashlist", err)
+	}
+
+	proj, err := db.GetProjectForUser(projId, user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	// Like stopping, make sure no more chunks get handed out first
+	err = db.SetAttackPaused(attackId)
+	if err != nil {
+		return util.ServerError("Failed to pause attack", err)
+	}
+
+	jobs, err := db.GetJobsForAttack(attackId, true, false)
 	if err != nil {
 		return util.ServerError("Failed to get jobs for attack", err)
 	}
 
 	for _, job := range jobs {
-		fleet.StopJob(job, db.JobStopReasonUserStopped)
+		switch job.RuntimeData.Status {
+		case db.JobStatusQueued, db.JobStatusAwaitingStart, db.JobStatusStarted:
+			fleet.PauseJob(job)
+		}
+	}
+	return c.JSON(http.StatusOK, "ok")
+}
+
+func handleAttackResume(c echo.Context) error {
+	attackId := c.Param("attack-id")
+	if !util.AreValidUUIDs(attackId) {
+		return echo.ErrBadRequest
+	}
+
+	if config.Get().General.IsMaintenanceMode {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Phatcrack is in maintenance mode. Attacks cannot be resumed.")
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	projId, err := db.GetAttackProjID(attackId)
+	if err != nil {
+		return util.ServerError("Failed to fetch project id for hashlist", err)
+	}
+
+	proj, err := db.GetProjectForUser(projId, user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	jobs, err := db.GetJobsForAttack(attackId, true, false)
+	if err != nil {
+		return util.ServerError("Failed to get jobs for attack", err)
+	}
+
+	for _, job := range jobs {
+		if job.RuntimeData.Status != db.JobStatusPaused {
+			continue
+		}
+
+		err = fleet.ResumeJob(job)
+		if err != nil {
+			return util.ServerError("Failed to resume job", err)
+		}
+	}
+
+	err = db.SetAttackResumed(attackId)
+	if err != nil {
+		return util.ServerError("Failed to resume attack", err)
+	}
+
+	fleet.QueueDispatch()
+
+	return c.JSON(http.StatusOK, "ok")
+}
+
+func handleAttackSetLimits(c echo.Context) error {
+	attackId := c.Param("attack-id")
+	if !util.AreValidUUIDs(attackId) {
+		return echo.ErrBadRequest
+	}
+
+	req, err := util.BindAndValidate[apitypes.AttackLimitsDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	projId, err := db.GetAttackProjID(attackId)
+	if err != nil {
+		return util.ServerError("Failed to fetch project id for attack", err)
+	}
+
+	proj, err := db.GetProjectForUser(projId, user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	err = db.SetAttackLimits(attackId, db.AttackLimitsFromDTO(req))
+	if err != nil {
+		return util.ServerError("Failed to set attack limits", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"attack_id":                            attackId,
+		"project_id":                           projId,
+		"project_name":                         proj.Name,
+		"max_runtime_minutes":                  req.MaxRuntimeMinutes,
+		"max_estimated_time_remaining_minutes": req.MaxEstimatedTimeRemainingMinutes,
+		"stop_at_cracked_percent":              req.StopAtCrackedPercent,
+	}, "User set attack limits")
+
+	// Check the new limits straight away, rather than waiting for the next reconciliation
+	fleet.QueueStateReconciliation()
+
+	return c.JSON(http.StatusOK, "ok")
+}
+
+func handleAttackSetAgentPlacement(c echo.Context) error {
+	attackId := c.Param("attack-id")
+	if !util.AreValidUUIDs(attackId) {
+		return echo.ErrBadRequest
+	}
+
+	req, err := util.BindAndValidate[apitypes.AgentPlacementDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	projId, err := db.GetAttackProjID(attackId)
+	if err != nil {
+		return util.ServerError("Failed to fetch project id for attack", err)
+	}
+
+	proj, err := db.GetProjectForUser(projId, user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
 	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	err = db.SetAttackAgentPlacement(attackId, db.AgentPlacementFromDTO(req))
+	if err != nil {
+		return util.ServerError("Failed to set attack agent placement", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"attack_id":              attackId,
+		"project_id":             projId,
+		"project_name":           proj.Name,
+		"required_agent_labels":  req.RequiredAgentLabels,
+		"forbidden_agent_labels": req.ForbiddenAgentLabels,
+	}, "User set attack agent placement")
+
+	// Queued jobs may now fit somewhere they didn't before. Jobs already running are left where they are
+	fleet.QueueDispatch()
+
 	return c.JSON(http.StatusOK, "ok")
 }
 
@@ -314,45 +527,9 @@ func handleAttackCreate(c echo.Context) error {
 		return util.ServerError("Failed to get information to validate hashcat params", err)
 	}
 
-	// Check all specified wordlists exactly match the ID of a known wordlist
-	for _, suppliedWordlist := range req.HashcatParams.WordlistFilenames {
-		found := false
-		for _, dbListfile := range listfiles {
-			if dbListfile.ID.String() == suppliedWordlist && dbListfile.FileType == db.ListfileTypeWordlist {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid wordlist supplied: %q", suppliedWordlist))
-		}
-	}
-
-	// Same for rulefiles
-	for _, suppliedRulefile := range req.HashcatParams.RulesFilenames {
-		found := false
-		for _, dbListfile := range listfiles {
-			if dbListfile.ID.String() == suppliedRulefile && dbListfile.FileType == db.ListfileTypeRulefile {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			return echo.NewHTTPError(http.StatusBadRequest, "Invalid rulefile supplied: %q", suppliedRulefile)
-		}
-	}
-
-	// Don't allow any additional args
-	req.HashcatParams.AdditionalArgs = []string{}
-
-	// Enforce correct hashtype
-	req.HashcatParams.HashType = uint(hashlist.HashType)
-
-	// hexlify mask custom charactersets
-	for i := range req.HashcatParams.MaskCustomCharsets {
-		req.HashcatParams.MaskCustomCharsets[i] = hex.EncodeToString([]byte(req.HashcatParams.MaskCustomCharsets[i]))
+	err = attackhelpers.PrepareHashcatParams(&req.HashcatParams, hashlist, listfiles)
+	if err != nil {
+		return attackHelperError("Failed to validate hashcat params", err)
 	}
 
 	hashcatParams := datatypes.NewJSONType(req.HashcatParams)
@@ -362,6 +539,8 @@ func handleAttackCreate(c echo.Context) error {
 		IsDistributed:  req.IsDistributed,
 		HashlistID:     uuid.MustParse(req.HashlistID),
 		ProgressString: "Created",
+		Limits:         db.AttackLimitsFromDTO(req.Limits),
+		AgentPlacement: db.AgentPlacementFromDTO(req.AgentPlacement),
 	})
 	if err != nil {
 		return util.ServerError("Failed to create new attack", err)
@@ -376,6 +555,149 @@ func handleAttackCreate(c echo.Context) error {
 	return c.JSON(http.StatusCreated, attack.ToDTO())
 }
 
+func handleAttackEstimate(c echo.Context) error {
+	req, err := util.BindAndValidate[apitypes.AttackEstimateRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	hashlist, err := db.GetHashlist(req.HashlistID)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch hashlist for estimate", err)
+	}
+
+	proj, err := db.GetProjectForUser(hashlist.ProjectID.String(), user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	listfiles, err := db.GetAllListfilesAvailableToProject(hashlist.ProjectID.String())
+	if err != nil {
+		return util.ServerError("Failed to get information to validate hashcat params", err)
+	}
+
+	err = attackhelpers.PrepareHashcatParams(&req.HashcatParams, hashlist, listfiles)
+	if err != nil {
+		return attackHelperError("Failed to validate hashcat params", err)
+	}
+
+	agentPoolId, err := db.GetProjectAgentPoolID(proj.ID.String())
+	if err != nil {
+		return util.ServerError("Failed to fetch project's agent pool", err)
+	}
+
+	constraints := db.AgentConstraints{
+		Placement:   db.AgentPlacementFromDTO(req.AgentPlacement).Merge(proj.AgentPlacement),
+		AgentPoolID: agentPoolId,
+	}
+
+	estimate, err := attacksharder.EstimateAttack(req.HashcatParams, req.IsDistributed, constraints)
+	if errors.Is(err, attacksharder.ErrCantEstimate) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return util.ServerError("Failed to estimate attack", err)
+	}
+
+	return c.JSON(http.StatusOK, estimate.ToDTO())
+}
+
+func handleAttackCreateFromTemplate(c echo.Context) error {
+	req, err := util.BindAndValidate[apitypes.AttackCreateFromTemplateRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	if req.Start && config.Get().General.IsMaintenanceMode {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Phatcrack is in maintenance mode. Attacks cannot be scheduled.")
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	hashlist, err := db.GetHashlist(req.HashlistID)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch hashlist for attack", err)
+	}
+
+	proj, err := db.GetProjectForUser(hashlist.ProjectID.String(), user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	progressString := "Created"
+	if req.Start {
+		progressString = "Processing (waiting to start).."
+	}
+
+	attacks, err := attackhelpers.CreateFromTemplate(hashlist, req.AttackTemplateID, req.IsDistributed, progressString)
+	if err == db.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, "Attack template not found")
+	}
+	if err != nil {
+		return attackHelperError("Failed to create new attacks", err)
+	}
+
+	attackIDs := make([]string, len(attacks))
+	for i, attack := range attacks {
+		attackIDs[i] = attack.ID.String()
+	}
+
+	AuditLog(c, log.Fields{
+		"project_id":         proj.ID.String(),
+		"project_name":       proj.Name,
+		"hashlist_id":        req.HashlistID,
+		"attack_template_id": req.AttackTemplateID,
+		"attack_ids":         attackIDs,
+		"started":            req.Start,
+	}, "New attacks created from template")
+
+	if req.Start {
+		// Splitting attacks up can take a while, so they're started one at a time in the background
+		go func() {
+			for _, attack := range attacks {
+				attackhelpers.StartWithProgress(attack, log.Fields{
+					"attack_id":    attack.ID,
+					"project_id":   proj.ID.String(),
+					"project_name": proj.Name,
+					"hashlist_id":  attack.HashlistID,
+				})
+			}
+		}()
+	}
+
+	return c.JSON(http.StatusCreated, apitypes.AttackCreateFromTemplateResponseDTO{
+		AttackIDs: attackIDs,
+	})
+}
+
 func handleAttackStart(c echo.Context) error {
 	attackId := c.Param("attack-id")
 	if !util.AreValidUUIDs(attackId) {
@@ -416,14 +738,6 @@ func handleAttackStart(c echo.Context) error {
 		return util.ServerError("Something went wrong getting attack to start", err)
 	}
 
-	db.SetAttackProgressString(attackId, "Processing (this can take a while)..")
-
-	jobMultiplier := config.Get().Agent.SplitJobsPerAgent
-	if jobMultiplier <= 0 {
-		jobMultiplier = 1
-	}
-	numJobs := fleet.NumSchedulableAgents() * jobMultiplier
-
 	errChan := make(chan error, 1)
 	successChan := make(chan apitypes.AttackStartResponseDTO, 1)
 
@@ -435,61 +749,12 @@ func handleAttackStart(c echo.Context) error {
 	}, "User has started attack")
 
 	go func() {
-		finalProgressString := "" // blank == success
-		defer func() {
-			// putting it in a func allows it to capture progress string properly
-			db.SetAttackProgressString(attackId, finalProgressString)
-		}()
-
-		newJobs, _, err := attacksharder.MakeJobs(attack, numJobs)
-
-		handleErr := func(err error) {
-			errId := uuid.NewString()
-			finalProgressString = "Error #" + errId
-			log.WithFields(log.Fields{
-				"attack_id":    attack.ID,
-				"project_id":   projId,
-				"project_name": proj.Name,
-				"hashlist_id":  attack.HashlistID,
-				"error_id":     errId,
-			}).WithError(err).Warn("Failed to start attack")
-			errChan <- err
-		}
-
-		if err == db.ErrNotFound {
-			errId := uuid.NewString()
-			finalProgressString = "Error #" + errId
-			log.WithFields(log.Fields{
-				"attack_id":    attack.ID,
-				"project_id":   projId,
-				"project_name": proj.Name,
-				"hashlist_id":  attack.HashlistID,
-				"error_id":     errId,
-			}).WithError(err).Error("Failed to start attack because it was not found")
-
-			errChan <- echo.ErrNotFound
-			return
-		}
-
-		if err != nil {
-			handleErr(util.ServerError("Something went wrong creating attack job", err))
-			return
-		}
-
-		db.SetAttackProgressString(attackId, "Scheduling jobs...")
-
-		jobIDs := []string{}
-		for _, job := range newJobs {
-			jobIDs = append(jobIDs, job.ID.String())
-		}
-		_, err = fleet.ScheduleJobs(jobIDs)
-
-		if err != nil {
-			for _, newJob := range newJobs {
-				// If the deletion fails, there's not much for us to do really
-				db.HardDelete(newJob)
-			}
-		}
+		jobIDs, err := attackhelpers.StartWithProgress(attack, log.Fields{
+			"attack_id":    attack.ID,
+			"project_id":   projId,
+			"project_name": proj.Name,
+			"hashlist_id":  attack.HashlistID,
+		})
 
 		switch err {
 		case nil:
@@ -498,17 +763,17 @@ func handleAttackStart(c echo.Context) error {
 				StillProcessing: false,
 			}
 
+		case db.ErrNotFound:
+			errChan <- echo.ErrNotFound
+
 		case fleet.ErrJobDoesntExist:
-			handleErr(echo.NewHTTPError(http.StatusNotFound, "Job doesn't exist"))
+			errChan <- echo.NewHTTPError(http.StatusNotFound, "Job doesn't exist")
 
 		case fleet.ErrJobAlreadyScheduled:
-			handleErr(echo.NewHTTPError(http.StatusBadRequest, "Job already scheduled"))
-
-		case fleet.ErrNoAgentsOnline:
-			handleErr(echo.NewHTTPError(http.StatusServiceUnavailable, "No agents are online"))
+			errChan <- echo.NewHTTPError(http.StatusBadRequest, "Job already scheduled")
 
 		default:
-			handleErr(util.ServerError("Unexpected error occured when scheduling job", err))
+			errChan <- util.ServerError("Something went wrong starting attack", err)
 		}
 
 		close(errChan)
@@ -581,9 +846,18 @@ func handleAttackRestartFailedJobs(c echo.Context) error {
 		"job_ids": failedJobIDs,
 	}, "User has restarted failed attack jobs")
 
-	_, err = fleet.ScheduleJobs(failedJobIDs)
+	err = fleet.QueueJobs(failedJobIDs)
 	if err != nil {
-		return util.ServerError("Failed to re-schedule jobs", err)
+		return util.ServerError("Failed to re-queue jobs", err)
 	}
 	return c.JSON(http.StatusOK, "ok")
-}
\ No newline at end of file
+}
+
+// Turns an error from attackhelpers into the right response, as bad settings are the user's problem rather than ours
+func attackHelperError(msg string, err error) error {
+	var validationErr *attackhelpers.ValidationError
+	if errors.As(err, &validationErr) {
+		return echo.NewHTTPError(http.StatusBadRequest, validationErr.Message)
+	}
+	return util.ServerError(msg, err)
+}
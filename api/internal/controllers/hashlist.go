@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"slices"
 
 	log "github.com/sirupsen/logrus"
 
@@ -24,9 +25,11 @@ func HookHashlistEndpoints(api *echo.Group) {
 	api.POST("/create", handleHashlistCreate)
 	api.GET("/:hashlist-id", handleHashlistGet)
 	api.POST("/:hashlist-id/append", handleHashlistAppend)
+	api.PUT("/:hashlist-id/tags", handleHashlistSetTags)
 	api.DELETE("/:hashlist-id", handleHashlistDelete)
 	api.GET("/:hashlist-id/attacks", handleAttackGetAllForHashlist)
 	api.GET("/:hashlist-id/attacks-with-jobs", handleAttacksAndJobsForHashlist)
+	api.GET("/:hashlist-id/pipelines", handleAttackPipelineGetAllForHashlist)
 }
 
 func handleHashlistGetAllForProj(c echo.Context) error {
@@ -198,6 +201,7 @@ func handleHashlistCreate(c echo.Context) error {
 		HasUsernames: req.HasUsernames,
 		HashType:     req.HashType,
 		Hashes:       hashes,
+		Tags:         normalizeHashlistTags(req.Tags),
 	})
 
 	if err != nil {
@@ -294,3 +298,63 @@ func handleHashlistAppend(c echo.Context) error {
 		NumPopulatedFromPotfile: numFromPotfile,
 	})
 }
+
+func handleHashlistSetTags(c echo.Context) error {
+	hashlistId := c.Param("hashlist-id")
+	if !util.AreValidUUIDs(hashlistId) {
+		return echo.ErrBadRequest
+	}
+
+	req, err := util.BindAndValidate[apitypes.HashlistSetTagsRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	allowed, err := accesscontrol.HasRightsToHashlistID(user, hashlistId)
+	if err != nil {
+		return util.ServerError("Failed to check access to hashlist", err)
+	}
+	if !allowed {
+		return echo.ErrForbidden
+	}
+
+	hashlist, err := db.GetHashlist(hashlistId)
+	if err == db.ErrNotFound {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return util.ServerError("Failed to load hashlist", err)
+	}
+
+	tags := normalizeHashlistTags(req.Tags)
+	err = db.SetHashlistTags(hashlistId, tags)
+	if err != nil {
+		return util.ServerError("Failed to set hashlist tags", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"hashlist_id":   hashlistId,
+		"hashlist_name": hashlist.Name,
+		"project_id":    hashlist.ProjectID.String(),
+		"tags":          tags,
+	}, "User set hashlist tags")
+
+	hashlist.Tags = tags
+	return c.JSON(http.StatusOK, hashlist.ToDTO(false))
+}
+
+// Sorts and removes duplicates, so tags come back the same way no matter how they were given
+func normalizeHashlistTags(tags []string) []string {
+	tags = slices.Clone(tags)
+	if tags == nil {
+		return []string{}
+	}
+
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lachlan2k/phatcrack/api/internal/accesscontrol"
+	"github.com/lachlan2k/phatcrack/api/internal/attackhelpers"
+	"github.com/lachlan2k/phatcrack/api/internal/auth"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/fleet"
+	"github.com/lachlan2k/phatcrack/api/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	log "github.com/sirupsen/logrus"
+)
+
+func HookAttackPipelineEndpoints(api *echo.Group) {
+	api.GET("/ping", func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong pipeline")
+	})
+
+	api.POST("/create", handleAttackPipelineCreate)
+	api.GET("/:pipeline-id", handleAttackPipelineGet)
+	api.DELETE("/:pipeline-id/stop", handleAttackPipelineStop)
+}
+
+// The attack modes that take a wordlist, which is what a stage's cracked plaintexts are fed in as
+var modesThatCanUseCrackedPlaintexts = []uint8{
+	hashcattypes.AttackModeDictionary,
+	hashcattypes.AttackModeCombinator,
+	hashcattypes.AttackModeHybridDM,
+	hashcattypes.AttackModeHybridMD,
+}
+
+func handleAttackPipelineCreate(c echo.Context) error {
+	req, err := util.BindAndValidate[apitypes.AttackPipelineCreateRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	hashlist, err := db.GetHashlist(req.HashlistID)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch hashlist for pipeline", err)
+	}
+
+	proj, err := db.GetProjectForUser(hashlist.ProjectID.String(), user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	listfiles, err := db.GetAllListfilesAvailableToProject(hashlist.ProjectID.String())
+	if err != nil {
+		return util.ServerError("Failed to get information to validate hashcat params", err)
+	}
+
+	// The wordlist of cracked plaintexts doesn't exist until the stage before finishes, so stages that use it are checked with this standing in for it
+	placeholderWordlist := db.Listfile{
+		UUIDBaseModel: db.UUIDBaseModel{ID: uuid.Nil},
+		FileType:      db.ListfileTypeWordlist,
+	}
+	listfilesWithPlaceholder := append(slices.Clone(listfiles), placeholderWordlist)
+
+	stages := make([]db.AttackPipelineStage, len(req.Stages))
+	for i, stage := range req.Stages {
+		params := stage.HashcatParams
+		stageListfiles := listfiles
+
+		if stage.UseCrackedPlaintexts {
+			if !slices.Contains(modesThatCanUseCrackedPlaintexts, params.AttackMode) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Stage %d can't use cracked plaintexts, as its attack mode doesn't take a wordlist", i+1))
+			}
+
+			params.WordlistFilenames = append([]string{placeholderWordlist.ID.String()}, params.WordlistFilenames...)
+			stageListfiles = listfilesWithPlaceholder
+		}
+
+		err = attackhelpers.PrepareHashcatParams(&params, hashlist, stageListfiles)
+		var validationErr *attackhelpers.ValidationError
+		if errors.As(err, &validationErr) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Stage %d: %s", i+1, validationErr.Message))
+		}
+		if err != nil {
+			return util.ServerError("Failed to validate hashcat params", err)
+		}
+
+		// The real wordlist is put in its place when the stage is started
+		if stage.UseCrackedPlaintexts {
+			params.WordlistFilenames = params.WordlistFilenames[1:]
+		}
+
+		stages[i] = db.AttackPipelineStage{
+			HashcatParams:        params,
+			UseCrackedPlaintexts: stage.UseCrackedPlaintexts,
+		}
+	}
+
+	pipeline, err := db.CreateAttackPipeline(&db.AttackPipeline{
+		Name:            req.Name,
+		Stages:          stages,
+		IsDistributed:   req.IsDistributed,
+		Status:          db.AttackPipelineStatusRunning,
+		StatusMessage:   "Starting",
+		HashlistID:      hashlist.ID,
+		CreatedByUserID: user.ID,
+	})
+	if err != nil {
+		return util.ServerError("Failed to create new pipeline", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"project_id":    proj.ID.String(),
+		"project_name":  proj.Name,
+		"hashlist_id":   req.HashlistID,
+		"pipeline_id":   pipeline.ID.String(),
+		"pipeline_name": pipeline.Name,
+	}, "New attack pipeline created")
+
+	fleet.QueuePipelineAdvance()
+
+	return c.JSON(http.StatusCreated, pipeline.ToDTO(nil))
+}
+
+func handleAttackPipelineGet(c echo.Context) error {
+	pipelineId := c.Param("pipeline-id")
+	if !util.AreValidUUIDs(pipelineId) {
+		return echo.ErrBadRequest
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	projId, err := db.GetAttackPipelineProjID(pipelineId)
+	if err != nil {
+		return util.ServerError("Failed to fetch project id for pipeline", err)
+	}
+
+	allowed, err := accesscontrol.HasRightsToProjectID(user, projId)
+	if err != nil {
+		return util.ServerError("Failed to check access to pipeline", err)
+	}
+	if !allowed {
+		return echo.ErrForbidden
+	}
+
+	pipeline, err := db.GetAttackPipeline(pipelineId)
+	if err == db.ErrNotFound {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch pipeline", err)
+	}
+
+	attackIds, err := db.GetAttackIDsForPipelines([]string{pipelineId})
+	if err != nil {
+		return util.ServerError("Failed to fetch attacks for pipeline", err)
+	}
+
+	return c.JSON(http.StatusOK, pipeline.ToDTO(attackIds[pipelineId]))
+}
+
+func handleAttackPipelineGetAllForHashlist(c echo.Context) error {
+	hashlistId := c.Param("hashlist-id")
+	if !util.AreValidUUIDs(hashlistId) {
+		return echo.ErrBadRequest
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	allowed, err := accesscontrol.HasRightsToHashlistID(user, hashlistId)
+	if err != nil {
+		return util.ServerError("Failed to check access to hashlist", err)
+	}
+	if !allowed {
+		return echo.ErrForbidden
+	}
+
+	pipelines, err := db.GetAllAttackPipelinesForHashlist(hashlistId)
+	if err != nil {
+		return util.ServerError("Failed to get pipelines for hashlist", err)
+	}
+
+	pipelineIds := make([]string, len(pipelines))
+	for i, pipeline := range pipelines {
+		pipelineIds[i] = pipeline.ID.String()
+	}
+
+	attackIds := map[string][]string{}
+	if len(pipelineIds) > 0 {
+		attackIds, err = db.GetAttackIDsForPipelines(pipelineIds)
+		if err != nil {
+			return util.ServerError("Failed to fetch attacks for pipelines", err)
+		}
+	}
+
+	pipelineDTOs := make([]apitypes.AttackPipelineDTO, len(pipelines))
+	for i, pipeline := range pipelines {
+		pipelineDTOs[i] = pipeline.ToDTO(attackIds[pipeline.ID.String()])
+	}
+
+	return c.JSON(http.StatusOK, apitypes.AttackPipelineMultipleDTO{
+		Pipelines: pipelineDTOs,
+	})
+}
+
+func handleAttackPipelineStop(c echo.Context) error {
+	pipelineId := c.Param("pipeline-id")
+	if !util.AreValidUUIDs(pipelineId) {
+		return echo.ErrBadRequest
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	projId, err := db.GetAttackPipelineProjID(pipelineId)
+	if err != nil {
+		return util.ServerError("Failed to fetch project id for pipeline", err)
+	}
+
+	proj, err := db.GetProjectForUser(projId, user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	if !accesscontrol.HasRightsToProject(user, proj) {
+		return echo.ErrForbidden
+	}
+
+	pipeline, err := db.GetAttackPipeline(pipelineId)
+	if err == db.ErrNotFound {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch pipeline", err)
+	}
+
+	// Stop the pipeline before its current attack, so it doesn't move on to the next stage when the attack finishes
+	stopped, err := db.UpdateRunningAttackPipeline(pipelineId, map[string]interface{}{
+		"status":         db.AttackPipelineStatusStopped,
+		"status_message": "Stopped by user",
+	})
+	if err != nil {
+		return util.ServerError("Failed to stop pipeline", err)
+	}
+	if !stopped {
+		return echo.NewHTTPError(http.StatusBadRequest, "Pipeline isn't running")
+	}
+
+	AuditLog(c, log.Fields{
+		"project_id":    proj.ID.String(),
+		"project_name":  proj.Name,
+		"pipeline_id":   pipelineId,
+		"pipeline_name": pipeline.Name,
+	}, "User stopped attack pipeline")
+
+	fleet.DiscardGeneratedWordlist(pipeline)
+
+	if pipeline.CurrentAttackID != nil {
+		err = fleet.StopAttack(pipeline.CurrentAttackID.String(), db.JobStopReasonUserStopped)
+		if err != nil {
+			return util.ServerError("Failed to stop pipeline's current attack", err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, "ok")
+}
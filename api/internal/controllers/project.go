@@ -25,6 +25,7 @@ func HookProjectEndpoints(api *echo.Group) {
 	api.POST("/create", handleProjectCreate)
 	api.GET("/:id", handleProjectGet)
 	api.DELETE("/:id", handleProjectDelete)
+	api.PUT("/:id/agent-placement", handleProjectSetAgentPlacement)
 
 	api.GET("/:id/listfiles", handleProjectListfilesGet)
 
@@ -141,6 +142,56 @@ func handleProjectDelete(c echo.Context) error {
 	return c.JSON(http.StatusOK, "ok")
 }
 
+func handleProjectSetAgentPlacement(c echo.Context) error {
+	projId := c.Param("id")
+	if !util.AreValidUUIDs(projId) {
+		return echo.ErrBadRequest
+	}
+
+	req, err := util.BindAndValidate[apitypes.AgentPlacementDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	proj, err := db.GetProjectForUser(projId, user)
+	if err == db.ErrNotFound {
+		return echo.ErrForbidden
+	}
+	if err != nil {
+		return util.ServerError("Failed to fetch project", err)
+	}
+
+	// This decides where everyone's attacks in the project can go, so only the owner gets a say
+	if !accesscontrol.HasOwnershipRightsToProject(user, proj) {
+		AuditLog(c, log.Fields{
+			"project_name": proj.Name,
+			"project_id":   proj.ID.String(),
+		}, "User tried to set a project's agent placement, but they are not allowed")
+		return echo.ErrForbidden
+	}
+
+	err = db.SetProjectAgentPlacement(projId, db.AgentPlacementFromDTO(req))
+	if err != nil {
+		return util.ServerError("Failed to set project agent placement", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"project_id":             projId,
+		"project_name":           proj.Name,
+		"required_agent_labels":  req.RequiredAgentLabels,
+		"forbidden_agent_labels": req.ForbiddenAgentLabels,
+	}, "User set project agent placement")
+
+	fleet.QueueDispatch()
+
+	return c.JSON(http.StatusOK, "ok")
+}
+
 func handleProjectGetAll(c echo.Context) error {
 	user := auth.UserFromReq(c)
 	if user == nil {
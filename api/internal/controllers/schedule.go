@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lachlan2k/phatcrack/api/internal/accesscontrol"
+	"github.com/lachlan2k/phatcrack/api/internal/attackhelpers"
+	"github.com/lachlan2k/phatcrack/api/internal/auth"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/roles"
+	"github.com/lachlan2k/phatcrack/api/internal/scheduler"
+	"github.com/lachlan2k/phatcrack/api/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	log "github.com/sirupsen/logrus"
+)
+
+// How many past runs are returned for a schedule
+const scheduleRunHistoryLimit = 50
+
+func HookAttackScheduleEndpoints(api *echo.Group) {
+	api.GET("/ping", func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong schedule")
+	})
+
+	api.GET("/all", handleAttackScheduleGetAll)
+	api.POST("/create", handleAttackScheduleCreate)
+	api.PUT("/:schedule-id/enabled", handleAttackScheduleSetEnabled)
+	api.DELETE("/:schedule-id", handleAttackScheduleDelete)
+	api.GET("/:schedule-id/runs", handleAttackScheduleGetRuns)
+}
+
+// Schedules belong to whoever made them, but admins can see and manage them all
+func canManageSchedule(user *db.User, schedule *db.AttackSchedule) bool {
+	return schedule.CreatedByUserID == user.ID || user.HasRole(roles.UserRoleAdmin)
+}
+
+// Loads the schedule from the request, as long as the user is allowed to manage it
+func getScheduleFromReq(c echo.Context, user *db.User) (*db.AttackSchedule, error) {
+	scheduleId := c.Param("schedule-id")
+	if !util.AreValidUUIDs(scheduleId) {
+		return nil, echo.ErrBadRequest
+	}
+
+	schedule, err := db.GetAttackSchedule(scheduleId)
+	if err == db.ErrNotFound {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, util.ServerError("Failed to fetch schedule", err)
+	}
+
+	if !canManageSchedule(user, schedule) {
+		return nil, echo.ErrForbidden
+	}
+
+	return schedule, nil
+}
+
+func handleAttackScheduleGetAll(c echo.Context) error {
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	var schedules []db.AttackSchedule
+	var err error
+	if user.HasRole(roles.UserRoleAdmin) {
+		schedules, err = db.GetAllAttackSchedules()
+	} else {
+		schedules, err = db.GetAllAttackSchedulesForUser(user.ID.String())
+	}
+	if err != nil {
+		return util.ServerError("Failed to get schedules", err)
+	}
+
+	res := apitypes.AttackScheduleMultipleDTO{
+		Schedules: make([]apitypes.AttackScheduleDTO, len(schedules)),
+	}
+	for i, schedule := range schedules {
+		res.Schedules[i] = schedule.ToDTO()
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func handleAttackScheduleCreate(c echo.Context) error {
+	req, err := util.BindAndValidate[apitypes.AttackScheduleCreateRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	schedule := &db.AttackSchedule{
+		Name:                  req.Name,
+		IsDistributed:         req.IsDistributed,
+		IsEnabled:             true,
+		NextRunAt:             time.Unix(req.StartAt, 0),
+		RepeatIntervalMinutes: req.RepeatIntervalMinutes,
+		CreatedByUserID:       user.ID,
+	}
+
+	logFields := log.Fields{
+		"schedule_name":           req.Name,
+		"start_at":                req.StartAt,
+		"repeat_interval_minutes": req.RepeatIntervalMinutes,
+	}
+
+	switch {
+	case req.AttackID != "" && req.AttackTemplateID == "" && req.HashlistTag == "":
+		projId, err := db.GetAttackProjID(req.AttackID)
+		if err == db.ErrNotFound {
+			return echo.ErrForbidden
+		}
+		if err != nil {
+			return util.ServerError("Failed to fetch project id for attack", err)
+		}
+
+		allowed, err := accesscontrol.HasRightsToProjectID(user, projId)
+		if err != nil {
+			return util.ServerError("Failed to check access to attack", err)
+		}
+		if !allowed {
+			return echo.ErrForbidden
+		}
+
+		attackId := uuid.MustParse(req.AttackID)
+		schedule.AttackID = &attackId
+		logFields["attack_id"] = req.AttackID
+		logFields["project_id"] = projId
+
+	case req.AttackID == "" && req.AttackTemplateID != "" && req.HashlistTag != "":
+		// Check the template is there and runnable now, rather than finding out when the schedule runs
+		_, err := attackhelpers.GetTemplates(req.AttackTemplateID)
+		if err == db.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Attack template not found")
+		}
+		if err != nil {
+			return attackHelperError("Failed to fetch attack template", err)
+		}
+
+		templateId := uuid.MustParse(req.AttackTemplateID)
+		schedule.AttackTemplateID = &templateId
+		schedule.HashlistTag = req.HashlistTag
+		logFields["attack_template_id"] = req.AttackTemplateID
+		logFields["hashlist_tag"] = req.HashlistTag
+
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "A schedule needs either an attack, or an attack template and a hashlist tag")
+	}
+
+	schedule, err = db.CreateAttackSchedule(schedule)
+	if err != nil {
+		return util.ServerError("Failed to create schedule", err)
+	}
+
+	logFields["schedule_id"] = schedule.ID.String()
+	AuditLog(c, logFields, "New attack schedule created")
+
+	scheduler.QueueScheduleCheck()
+
+	return c.JSON(http.StatusCreated, schedule.ToDTO())
+}
+
+func handleAttackScheduleSetEnabled(c echo.Context) error {
+	req, err := util.BindAndValidate[apitypes.AttackScheduleSetEnabledRequestDTO](c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	schedule, err := getScheduleFromReq(c, user)
+	if err != nil {
+		return err
+	}
+
+	err = db.SetAttackScheduleEnabled(schedule.ID.String(), req.IsEnabled)
+	if err != nil {
+		return util.ServerError("Failed to update schedule", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"schedule_id":   schedule.ID.String(),
+		"schedule_name": schedule.Name,
+		"is_enabled":    req.IsEnabled,
+	}, "User enabled/disabled attack schedule")
+
+	if req.IsEnabled {
+		scheduler.QueueScheduleCheck()
+	}
+
+	schedule.IsEnabled = req.IsEnabled
+	return c.JSON(http.StatusOK, schedule.ToDTO())
+}
+
+func handleAttackScheduleDelete(c echo.Context) error {
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	schedule, err := getScheduleFromReq(c, user)
+	if err != nil {
+		return err
+	}
+
+	err = db.DeleteAttackSchedule(schedule.ID.String())
+	if err != nil {
+		return util.ServerError("Failed to delete schedule", err)
+	}
+
+	AuditLog(c, log.Fields{
+		"schedule_id":   schedule.ID.String(),
+		"schedule_name": schedule.Name,
+	}, "User deleted attack schedule")
+
+	return c.JSON(http.StatusOK, "ok")
+}
+
+func handleAttackScheduleGetRuns(c echo.Context) error {
+	user := auth.UserFromReq(c)
+	if user == nil {
+		return echo.ErrForbidden
+	}
+
+	schedule, err := getScheduleFromReq(c, user)
+	if err != nil {
+		return err
+	}
+
+	runs, err := db.GetAttackScheduleRuns(schedule.ID.String(), scheduleRunHistoryLimit)
+	if err != nil {
+		return util.ServerError("Failed to get schedule runs", err)
+	}
+
+	res := apitypes.AttackScheduleRunMultipleDTO{
+		Runs: make([]apitypes.AttackScheduleRunDTO, len(runs)),
+	}
+	for i, run := range runs {
+		res.Runs[i] = run.ToDTO()
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
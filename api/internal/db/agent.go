@@ -1,6 +1,7 @@
 package db
 
 import (
+	"slices"
 	"strconv"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/lachlan2k/phatcrack/api/internal/util"
 	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
 	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	"github.com/lib/pq"
 	"gorm.io/datatypes"
 )
 
@@ -23,9 +25,22 @@ type Agent struct {
 	Name              string
 	KeyHash           string
 	IsMaintenanceMode bool `gorm:"default:false; not null"`
-	Ephemeral         bool
+	// Draining agents aren't given new work, so they can be safely taken down once their running jobs are done (or moved)
+	IsDraining bool `gorm:"default:false; not null"`
+	Ephemeral  bool
+	// Set by an admin to override what the agent reports, 0 means use the agent's value
+	MaxConcurrentJobs int `gorm:"default:0; not null"`
 	AgentInfo         datatypes.JSONType[AgentInfo]
 	AgentDevices      datatypes.JSONType[AgentDeviceInfo]
+	AgentBenchmarks   datatypes.JSONType[AgentBenchmarks] `gorm:"default:'{}'; not null"`
+	// What the agent told us about itself when it last connected
+	AgentCapabilities datatypes.JSONType[AgentCapabilities] `gorm:"default:'{}'; not null"`
+	// Set by an admin, so attacks can require or avoid particular agents, e.g. site=dc1 or classified
+	Labels pq.StringArray `gorm:"type:text[]"`
+	// Nil if the agent is part of the shared fleet
+	AgentPoolID *uuid.UUID `gorm:"type:uuid"`
+	// Set by an admin to override the thermal policy in the agent's config
+	ThermalPolicy datatypes.JSONType[AgentThermalPolicy] `gorm:"default:'{}'; not null"`
 }
 
 type AgentRegistrationKey struct {
@@ -56,6 +71,91 @@ type AgentDeviceInfo struct {
 	Devices []hashcattypes.HashcatStatusDevice
 }
 
+type AgentCapabilities struct {
+	HashcatVersion     string                              `json:"hashcat_version"`
+	OS                 string                              `json:"os"`
+	Arch               string                              `json:"arch"`
+	Devices            []hashcattypes.HashcatBackendDevice `json:"devices"`
+	SupportedHashTypes []uint                              `json:"supported_hash_types"`
+	ListfileDiskFree   uint64                              `json:"listfile_disk_free"`
+	Errors             []string                            `json:"errors"`
+	TimeReported       time.Time                           `json:"time_reported"`
+}
+
+func (a AgentCapabilities) ToDTO() apitypes.AgentCapabilitiesDTO {
+	devices := a.Devices
+	if devices == nil {
+		devices = []hashcattypes.HashcatBackendDevice{}
+	}
+	supportedHashTypes := a.SupportedHashTypes
+	if supportedHashTypes == nil {
+		supportedHashTypes = []uint{}
+	}
+	agentErrors := a.Errors
+	if agentErrors == nil {
+		agentErrors = []string{}
+	}
+
+	timeReported := int64(0)
+	if !a.TimeReported.IsZero() {
+		timeReported = a.TimeReported.Unix()
+	}
+
+	return apitypes.AgentCapabilitiesDTO{
+		HashcatVersion:     a.HashcatVersion,
+		OS:                 a.OS,
+		Arch:               a.Arch,
+		Devices:            devices,
+		SupportedHashTypes: supportedHashTypes,
+		ListfileDiskFree:   a.ListfileDiskFree,
+		Errors:             agentErrors,
+		TimeReported:       timeReported,
+	}
+}
+
+// The latest benchmark the agent ran for a hash type
+type AgentBenchmark struct {
+	HashType uint                                  `json:"hash_type"`
+	Hashrate int64                                 `json:"hashrate"`
+	Devices  []hashcattypes.HashcatBenchmarkDevice `json:"devices"`
+	Time     time.Time                             `json:"time"`
+	Error    string                                `json:"error,omitempty"`
+}
+
+type AgentBenchmarks struct {
+	Results []AgentBenchmark `json:"results"`
+}
+
+func (a AgentBenchmark) ToDTO() apitypes.AgentBenchmarkDTO {
+	devices := a.Devices
+	if devices == nil {
+		devices = []hashcattypes.HashcatBenchmarkDevice{}
+	}
+
+	return apitypes.AgentBenchmarkDTO{
+		HashType: a.HashType,
+		Hashrate: a.Hashrate,
+		Devices:  devices,
+		Time:     a.Time.Unix(),
+		Error:    a.Error,
+	}
+}
+
+// Zero values leave the agent's own setting alone
+type AgentThermalPolicy struct {
+	TempAbort int    `json:"temp_abort"`
+	MaxTemp   int    `json:"max_temp"`
+	Action    string `json:"action"`
+}
+
+func (p AgentThermalPolicy) ToDTO() apitypes.AgentThermalPolicyDTO {
+	return apitypes.AgentThermalPolicyDTO{
+		TempAbort: p.TempAbort,
+		MaxTemp:   p.MaxTemp,
+		Action:    p.Action,
+	}
+}
+
 type AgentInfo struct {
 	Status               string      `json:"status"`
 	Version              string      `json:"version"`
@@ -64,6 +164,57 @@ type AgentInfo struct {
 	TimeOfLastConnect    time.Time   `json:"time_of_last_connect,omitempty"`
 	AvailableListfiles   []AgentFile `json:"available_listfiles,omitempty"`
 	ActiveJobIDs         []string    `json:"active_job_ids,omitempty"`
+	MaxConcurrentJobs    int         `json:"max_concurrent_jobs,omitempty"`
+}
+
+// Whether the agent was being drained and has nothing left running, so it's safe to take down
+func (a Agent) IsDrained() bool {
+	return a.IsDraining && len(a.AgentInfo.Data().ActiveJobIDs) == 0
+}
+
+// The IDs of the devices the agent has run jobs on, in order, as hashcat numbers them for --backend-devices
+func (a Agent) DeviceIDs() []int {
+	deviceIds := []int{}
+	for _, device := range a.AgentDevices.Data().Devices {
+		deviceIds = append(deviceIds, device.DeviceID)
+	}
+	slices.Sort(deviceIds)
+	return slices.Compact(deviceIds)
+}
+
+// How many jobs the scheduler is allowed to have running on this agent at once
+// Once we know what devices an agent has, each device can have its own job, up to as many as the agent says it's happy to run,
+// unless an admin says otherwise
+func (a Agent) JobSlots() int {
+	if a.MaxConcurrentJobs > 0 {
+		return a.MaxConcurrentJobs
+	}
+
+	reported := a.AgentInfo.Data().MaxConcurrentJobs
+	deviceCount := len(a.DeviceIDs())
+	if deviceCount > 0 {
+		if reported > 0 {
+			return min(reported, deviceCount)
+		}
+		return deviceCount
+	}
+
+	if reported > 0 {
+		return reported
+	}
+
+	// Older agents don't report anything, so assume they can only handle one job at a time
+	return 1
+}
+
+// The agent's benchmarked speed for the hash type, if it has successfully benchmarked it
+func (a Agent) BenchmarkedHashrate(hashType uint) (int64, bool) {
+	for _, benchmark := range a.AgentBenchmarks.Data().Results {
+		if benchmark.HashType == hashType && benchmark.Error == "" && benchmark.Hashrate > 0 {
+			return benchmark.Hashrate, true
+		}
+	}
+	return 0, false
 }
 
 func (a AgentFile) ToDTO() apitypes.AgentFileDTO {
@@ -85,16 +236,37 @@ func (a AgentInfo) ToDTO() apitypes.AgentInfoDTO {
 		LastCheckInTime:    a.TimeOfLastHeartbeat.Unix(),
 		AvailableListfiles: listfileDTOs,
 		ActiveJobIDs:       a.ActiveJobIDs,
+		MaxConcurrentJobs:  a.MaxConcurrentJobs,
 	}
 }
 
 func (a Agent) ToDTO() apitypes.AgentDTO {
+	benchmarks := a.AgentBenchmarks.Data().Results
+	benchmarkDTOs := make([]apitypes.AgentBenchmarkDTO, len(benchmarks))
+	for i, benchmark := range benchmarks {
+		benchmarkDTOs[i] = benchmark.ToDTO()
+	}
+
+	labels := []string(a.Labels)
+	if labels == nil {
+		labels = []string{}
+	}
+
 	return apitypes.AgentDTO{
 		ID:                a.ID.String(),
 		Name:              a.Name,
 		IsMaintenanceMode: a.IsMaintenanceMode,
+		IsDraining:        a.IsDraining,
+		IsDrained:         a.IsDrained(),
+		MaxConcurrentJobs: a.MaxConcurrentJobs,
+		JobSlots:          a.JobSlots(),
 		AgentInfo:         a.AgentInfo.Data().ToDTO(),
 		AgentDevices:      a.AgentDevices.Data().Devices,
+		AgentBenchmarks:   benchmarkDTOs,
+		AgentCapabilities: a.AgentCapabilities.Data().ToDTO(),
+		Labels:            labels,
+		AgentPoolID:       agentPoolIDToString(a.AgentPoolID),
+		ThermalPolicy:     a.ThermalPolicy.Data().ToDTO(),
 	}
 }
 
@@ -186,7 +358,7 @@ func GetAllHealthyAgents() ([]Agent, error) {
 
 func GetAllSchedulableAgents() ([]Agent, error) {
 	agents := []Agent{}
-	err := GetInstance().Find(&agents, "agent_info->>'status' = ? and is_maintenance_mode = false", AgentStatusHealthy).Error
+	err := GetInstance().Find(&agents, "agent_info->>'status' = ? and is_maintenance_mode = false and is_draining = false", AgentStatusHealthy).Error
 	if err != nil {
 		return nil, err
 	}
@@ -227,15 +399,62 @@ func FindAgentIDByAuthKey(authKey string) (string, error) {
 	return result.ID.String(), nil
 }
 
+// Jobs only report the devices they were given, so this updates those devices and leaves the agent's others alone
+// Reads then writes the agent, so callers need to make sure they aren't racing each other (i.e. hold the fleet lock)
 func UpdateAgentDevices(agentId string, devices []hashcattypes.HashcatStatusDevice) error {
+	agent, err := GetAgent(agentId)
+	if err != nil {
+		return err
+	}
+
+	merged := slices.DeleteFunc(agent.AgentDevices.Data().Devices, func(existing hashcattypes.HashcatStatusDevice) bool {
+		return slices.ContainsFunc(devices, func(device hashcattypes.HashcatStatusDevice) bool {
+			return device.DeviceID == existing.DeviceID
+		})
+	})
+	merged = append(merged, devices...)
+	slices.SortFunc(merged, func(a, b hashcattypes.HashcatStatusDevice) int {
+		return a.DeviceID - b.DeviceID
+	})
+
 	return GetInstance().
 		Table("agents").
 		Where("id", agentId).
 		Update("agent_devices", AgentDeviceInfo{
-			Devices: devices,
+			Devices: merged,
 		}).Error
 }
 
+// Replaces any earlier benchmark of the same hash type, unless the new one failed and the old one didn't
+// Reads then writes the agent, so callers need to make sure they aren't racing each other (i.e. hold the fleet lock)
+func UpdateAgentBenchmark(agentId string, benchmark AgentBenchmark) error {
+	agent, err := GetAgent(agentId)
+	if err != nil {
+		return err
+	}
+
+	benchmarks := agent.AgentBenchmarks.Data()
+	results := []AgentBenchmark{}
+	for _, existing := range benchmarks.Results {
+		if existing.HashType != benchmark.HashType {
+			results = append(results, existing)
+			continue
+		}
+
+		// An agent that was too busy to benchmark shouldn't lose the last result that worked
+		if benchmark.Error != "" && existing.Error == "" {
+			return nil
+		}
+	}
+	benchmarks.Results = append(results, benchmark)
+
+	return GetInstance().Table("agents").Where("id", agentId).Update("agent_benchmarks", benchmarks).Error
+}
+
+func UpdateAgentCapabilities(agentId string, capabilities AgentCapabilities) error {
+	return GetInstance().Table("agents").Where("id", agentId).Update("agent_capabilities", capabilities).Error
+}
+
 func UpdateAgentStatus(agentId string, status string) error {
 	return GetInstance().
 		Table("agents").
@@ -253,3 +472,19 @@ func UpdateAgentInfo(agentId string, info AgentInfo) error {
 func UpdateAgentMaintenanceMode(agentId string, isMaintenance bool) error {
 	return GetInstance().Table("agents").Where("id", agentId).Update("is_maintenance_mode", isMaintenance).Error
 }
+
+func UpdateAgentDraining(agentId string, isDraining bool) error {
+	return GetInstance().Table("agents").Where("id", agentId).Update("is_draining", isDraining).Error
+}
+
+func UpdateAgentMaxConcurrentJobs(agentId string, maxConcurrentJobs int) error {
+	return GetInstance().Table("agents").Where("id", agentId).Update("max_concurrent_jobs", maxConcurrentJobs).Error
+}
+
+func UpdateAgentThermalPolicy(agentId string, policy AgentThermalPolicy) error {
+	return GetInstance().Table("agents").Where("id = ?", agentId).Update("thermal_policy", datatypes.NewJSONType(policy)).Error
+}
+
+func UpdateAgentLabels(agentId string, labels []string) error {
+	return GetInstance().Table("agents").Where("id", agentId).Update("labels", pq.StringArray(labels)).Error
+}
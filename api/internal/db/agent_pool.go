@@ -0,0 +1,129 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"gorm.io/gorm"
+)
+
+// A group of agents set aside for particular projects or users, e.g. dedicated rigs for a client engagement
+// Pooled agents only run work from their pool's projects and users, and that work only runs on the pool
+type AgentPool struct {
+	UUIDBaseModel
+	Name        string
+	Description string
+}
+
+func (p *AgentPool) ToDTO() apitypes.AgentPoolDTO {
+	return apitypes.AgentPoolDTO{
+		ID:          p.ID.String(),
+		TimeCreated: p.CreatedAt.Unix(),
+		Name:        p.Name,
+		Description: p.Description,
+	}
+}
+
+// Everything that decides which agents an attack's jobs may go to
+type AgentConstraints struct {
+	Placement AgentPlacement
+	// Nil if the work belongs to the shared fleet, rather than a pool
+	AgentPoolID *uuid.UUID
+}
+
+func (c AgentConstraints) Allows(agent Agent) bool {
+	if !sameAgentPool(c.AgentPoolID, agent.AgentPoolID) {
+		return false
+	}
+	return c.Placement.Allows(agent)
+}
+
+func sameAgentPool(a *uuid.UUID, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func agentPoolIDFromString(poolId string) *uuid.UUID {
+	if poolId == "" {
+		return nil
+	}
+	id := uuid.MustParse(poolId)
+	return &id
+}
+
+func agentPoolIDToString(poolId *uuid.UUID) string {
+	if poolId == nil {
+		return ""
+	}
+	return poolId.String()
+}
+
+func CreateAgentPool(pool *AgentPool) (*AgentPool, error) {
+	return pool, GetInstance().Create(pool).Error
+}
+
+func GetAgentPool(id string) (*AgentPool, error) {
+	pool := &AgentPool{}
+	err := GetInstance().First(pool, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+func GetAllAgentPools() ([]AgentPool, error) {
+	pools := []AgentPool{}
+	err := GetInstance().Order("name ASC").Find(&pools).Error
+	if err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+// Deletes the pool, and puts its agents, projects and users back in the shared fleet
+func DeleteAgentPool(id string) error {
+	return GetInstance().Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"agents", "projects", "users"} {
+			err := tx.Table(table).Where("agent_pool_id = ?", id).Update("agent_pool_id", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("id = ?", id).Delete(&AgentPool{}).Error
+	})
+}
+
+// poolId of "" takes the agent out of any pool
+func SetAgentAgentPool(agentId string, poolId string) error {
+	return GetInstance().Table("agents").Where("id = ?", agentId).Update("agent_pool_id", agentPoolIDFromString(poolId)).Error
+}
+
+// poolId of "" puts the project's jobs back on the shared fleet, unless its owner is in a pool
+func SetProjectAgentPool(projectId string, poolId string) error {
+	return GetInstance().Table("projects").Where("id = ?", projectId).Update("agent_pool_id", agentPoolIDFromString(poolId)).Error
+}
+
+// poolId of "" puts the user's projects back on the shared fleet, unless a project has its own pool
+func SetUserAgentPool(userId string, poolId string) error {
+	return GetInstance().Table("users").Where("id = ?", userId).Update("agent_pool_id", agentPoolIDFromString(poolId)).Error
+}
+
+// The pool the project's jobs have to run on, which is its own, or otherwise its owner's. Nil means the shared fleet
+func GetProjectAgentPoolID(projectId string) (*uuid.UUID, error) {
+	result := struct {
+		AgentPoolID *uuid.UUID
+	}{}
+
+	err := GetInstance().
+		Table("projects").
+		Select("coalesce(projects.agent_pool_id, users.agent_pool_id) as agent_pool_id").
+		Joins("left join users on users.id = projects.owner_user_id").
+		Where("projects.id = ?", projectId).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result.AgentPoolID, nil
+}
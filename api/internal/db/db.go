@@ -107,6 +107,7 @@ func GetInstance() *gorm.DB {
 func runMigrations() {
 	instance := GetInstance()
 
+	instance.AutoMigrate(&AgentPool{})
 	instance.AutoMigrate(&Agent{})
 	instance.AutoMigrate(&AgentRegistrationKey{})
 
@@ -124,6 +125,9 @@ func runMigrations() {
 	instance.AutoMigrate(&Attack{})
 	instance.AutoMigrate(&AttackTemplate{})
 	instance.AutoMigrate(&AttackTemplateSet{})
+	instance.AutoMigrate(&AttackPipeline{})
+	instance.AutoMigrate(&AttackSchedule{})
+	instance.AutoMigrate(&AttackScheduleRun{})
 
 	instance.AutoMigrate(&User{})
 
@@ -134,7 +138,7 @@ func runMigrations() {
 func WipeEverything() error {
 	instance := GetInstance()
 
-	toDelete := []interface{}{&Agent{}, &Job{}, &JobRuntimeData{}, &Listfile{}, &PotfileEntry{}, &Project{}, &ProjectShare{}, &Hashlist{}, &HashlistHash{}, &Attack{}, &User{}, &Config{}}
+	toDelete := []interface{}{&AgentPool{}, &Agent{}, &Job{}, &JobRuntimeData{}, &Listfile{}, &PotfileEntry{}, &Project{}, &ProjectShare{}, &Hashlist{}, &HashlistHash{}, &Attack{}, &AttackPipeline{}, &AttackSchedule{}, &AttackScheduleRun{}, &User{}, &Config{}}
 
 	return instance.Transaction(func(tx *gorm.DB) error {
 		for _, d := range toDelete {
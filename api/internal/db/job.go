@@ -8,6 +8,7 @@ import (
 	"github.com/lachlan2k/phatcrack/api/internal/roles"
 	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
 	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
 	"github.com/lib/pq"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -16,10 +17,14 @@ import (
 const (
 	// Created, not started
 	JobStatusCreated       = "JobStatus-Created"
+	// Started, waiting in the queue for an agent to pick it up
+	JobStatusQueued        = "JobStatus-Queued"
 	// Created, started, assigned to agent, waiting for agent to confirm start
 	JobStatusAwaitingStart = "JobStatus-AwaitingStart"
 	// in progress
 	JobStatusStarted       = "JobStatus-Started"
+	// stopped part way through, can be resumed from RestorePoint
+	JobStatusPaused        = "JobStatus-Paused"
 	// exited (could be good, could be bad)
 	JobStatusExited        = "JobStatus-Exited"
 )
@@ -35,6 +40,10 @@ const (
 	JobStopReasonFailed = "JobStopReason-Failed"
 	// Agent timed out and we lost contact
 	JobStopReasonTimeout = "JobStopReason-Timeout"
+	// The attack went over one of its limits, e.g. how long it was allowed to run for
+	JobStopReasonBudgetExceeded = "JobStopReason-BudgetExceeded"
+	// One of the agent's devices got too hot, so the agent stopped it
+	JobStopReasonThermalLimit = wstypes.JobStopReasonThermalLimit
 )
 
 type Job struct {
@@ -50,10 +59,18 @@ type Job struct {
 	TargetHashes pq.StringArray `gorm:"type:text[]"`
 	HashType     int
 
+	// For association attacks, the hint for each of TargetHashes, in the same order
+	AssociatedHints pq.StringArray `gorm:"type:text[]"`
+
 	RuntimeData JobRuntimeData `gorm:"constraint:OnDelete:CASCADE;"`
 
 	AssignedAgent   Agent      `gorm:"constraint:OnDelete:SET NULL;"`
 	AssignedAgentID *uuid.UUID `gorm:"type:uuid"`
+	// Which of the assigned agent's devices the job was given, empty if it was given all of them
+	AssignedDevices pq.Int64Array `gorm:"type:bigint[]"`
+
+	// The agent this job was sized for when the attack was sharded, the dispatcher will try to give it to them
+	PreferredAgentID *uuid.UUID `gorm:"type:uuid"`
 }
 
 func (j Job) HasFailed() bool {
@@ -64,6 +81,8 @@ type JobRuntimeData struct {
 	SimpleBaseModel
 	JobID uuid.UUID `gorm:"type:uuid"`
 
+	// when the job was put in the queue
+	QueuedTime time.Time
 	// when we ask the job to start
 	StartRequestTime time.Time
 	// when it actually starts on the agent
@@ -75,6 +94,15 @@ type JobRuntimeData struct {
 
 	CmdLine string // hashcat command
 
+	// The latest restore point hashcat has told us about, used to resume paused jobs
+	RestorePoint int64
+	// How many times we've put the job back in the queue because the agent running it died
+	RecoveryCount int
+	// Set when the job is being moved off its agent, so it goes straight back in the queue once it has paused
+	IsMigrating bool `gorm:"default:false; not null"`
+	// Set when the job has been asked to pause, until the agent tells us it has, so we can ask again if the agent missed it
+	IsPausing bool `gorm:"default:false; not null"`
+
 	OutputLines   pgJSONBArray[JobRuntimeOutputLine]
 	StatusUpdates pgJSONBArray[hashcattypes.HashcatStatus]
 }
@@ -99,6 +127,11 @@ func (j Job) ToDTO() apitypes.JobDTO {
 		HashType:        j.HashType,
 		RuntimeData:     j.RuntimeData.ToDTO(),
 		RuntimeSummary:  j.RuntimeData.ToSummaryDTO(),
+		AssignedDevices: make([]int, len(j.AssignedDevices)),
+	}
+
+	for i, deviceId := range j.AssignedDevices {
+		dto.AssignedDevices[i] = int(deviceId)
 	}
 
 	if j.AssignedAgentID == nil {
@@ -121,6 +154,7 @@ func (r JobRuntimeData) ToDTO() apitypes.JobRuntimeDataDTO {
 	}
 
 	return apitypes.JobRuntimeDataDTO{
+		QueuedTime:       r.QueuedTime,
 		StartRequestTime: r.StartRequestTime,
 
 		StartedTime: r.StartedTime,
@@ -129,6 +163,9 @@ func (r JobRuntimeData) ToDTO() apitypes.JobRuntimeDataDTO {
 		StopReason:  r.StopReason,
 		ErrorString: r.ErrorString,
 
+		RestorePoint:  r.RestorePoint,
+		RecoveryCount: r.RecoveryCount,
+
 		OutputLines:   outlines,
 		StatusUpdates: r.StatusUpdates.Unwrap(),
 		CmdLine:       r.CmdLine,
@@ -216,6 +253,23 @@ func GetAllPendingJobs(includeRuntimeData bool) ([]Job, error) {
 	return jobs, err
 }
 
+// Returns queued jobs, oldest first
+func GetAllQueuedJobs() ([]Job, error) {
+	jobs := []Job{}
+
+	err := GetInstance().
+		Preload("RuntimeData").
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("job_runtime_data.status = ?", JobStatusQueued).
+		Order("job_runtime_data.queued_time ASC").
+		Find(&jobs).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
 func GetAllIncompleteJobs(includeRuntimeData bool) ([]Job, error) {
 	jobs := []Job{}
 	inst := GetInstance()
@@ -234,6 +288,139 @@ func GetAllIncompleteJobs(includeRuntimeData bool) ([]Job, error) {
 	return jobs, err
 }
 
+func GetRunningJobsForAgent(agentId string) ([]Job, error) {
+	jobs := []Job{}
+
+	err := GetInstance().
+		Preload("RuntimeData").
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("job_runtime_data.status = ? and jobs.assigned_agent_id = ?", JobStatusStarted, agentId).
+		Find(&jobs).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Counts the jobs that each agent has been given and hasn't finished yet, keyed by agent ID
+func GetAssignedJobCountPerAgent() (map[string]int, error) {
+	results := []struct {
+		AssignedAgentID uuid.UUID
+		JobCount        int
+	}{}
+
+	err := GetInstance().
+		Table("jobs").
+		Select("jobs.assigned_agent_id as assigned_agent_id, count(jobs.id) as job_count").
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("job_runtime_data.status in ? and jobs.assigned_agent_id is not null", []string{JobStatusAwaitingStart, JobStatusStarted}).
+		Group("jobs.assigned_agent_id").
+		Scan(&results).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(results))
+	for _, result := range results {
+		counts[result.AssignedAgentID.String()] = result.JobCount
+	}
+	return counts, nil
+}
+
+// The devices given to each agent's unfinished jobs, one list per job, keyed by agent ID
+// A job that was given all of the agent's devices has an empty list
+func GetAssignedDevicesPerAgent() (map[string][][]int, error) {
+	results := []struct {
+		AssignedAgentID uuid.UUID
+		AssignedDevices pq.Int64Array `gorm:"type:bigint[]"`
+	}{}
+
+	err := GetInstance().
+		Table("jobs").
+		Select("jobs.assigned_agent_id as assigned_agent_id, jobs.assigned_devices as assigned_devices").
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("job_runtime_data.status in ? and jobs.assigned_agent_id is not null", []string{JobStatusAwaitingStart, JobStatusStarted}).
+		Scan(&results).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make(map[string][][]int, len(results))
+	for _, result := range results {
+		jobDevices := make([]int, len(result.AssignedDevices))
+		for i, deviceId := range result.AssignedDevices {
+			jobDevices[i] = int(deviceId)
+		}
+		agentId := result.AssignedAgentID.String()
+		devices[agentId] = append(devices[agentId], jobDevices)
+	}
+	return devices, nil
+}
+
+func deviceIDsToArray(devices []int) pq.Int64Array {
+	array := make(pq.Int64Array, len(devices))
+	for i, deviceId := range devices {
+		array[i] = int64(deviceId)
+	}
+	return array
+}
+
+// Uses the most recent status updates of recent jobs to work out each agent's total hashrate for a hash type, keyed by agent ID
+// An agent can be running several jobs at once, each on some of its devices, so the latest speed of each device is added up
+// Agents that haven't run a job of that hash type since the given time are left out
+func GetRecentAgentHashrates(hashType int, since time.Time) (map[string]int64, error) {
+	results := []struct {
+		AssignedAgentID  uuid.UUID
+		LastStatusUpdate datatypes.JSONType[hashcattypes.HashcatStatus]
+	}{}
+
+	err := GetInstance().
+		Table("jobs").
+		Select("jobs.assigned_agent_id as assigned_agent_id, job_runtime_data.status_updates[array_upper(job_runtime_data.status_updates, 1)] as last_status_update").
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("jobs.hash_type = ? and jobs.assigned_agent_id is not null and job_runtime_data.started_time > ?", hashType, since).
+		Where("array_length(job_runtime_data.status_updates, 1) > 0").
+		Order("job_runtime_data.started_time DESC").
+		Scan(&results).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest jobs come first, so the first speed we see for a device is its latest
+	deviceSpeeds := make(map[string]map[int]int64)
+	for _, result := range results {
+		agentId := result.AssignedAgentID.String()
+		if deviceSpeeds[agentId] == nil {
+			deviceSpeeds[agentId] = make(map[int]int64)
+		}
+
+		for _, dev := range result.LastStatusUpdate.Data().Devices {
+			if _, ok := deviceSpeeds[agentId][dev.DeviceID]; ok {
+				continue
+			}
+			deviceSpeeds[agentId][dev.DeviceID] = int64(dev.Speed)
+		}
+	}
+
+	hashrates := make(map[string]int64)
+	for agentId, speeds := range deviceSpeeds {
+		hashrate := int64(0)
+		for _, speed := range speeds {
+			hashrate += speed
+		}
+
+		if hashrate > 0 {
+			hashrates[agentId] = hashrate
+		}
+	}
+
+	return hashrates, nil
+}
+
 type RunningJobForUser struct {
 	ProjectID  uuid.UUID
 	HashlistID uuid.UUID
@@ -453,7 +640,201 @@ func SetJobExited(jobId string, reason string, errStr string, exitTime time.Time
 	})
 }
 
-func SetJobScheduled(jobId string, agentId string) error {
+func SetJobQueued(jobId string) error {
+	jobUuid, err := uuid.Parse(jobId)
+	if err != nil {
+		return err
+	}
+
+	return GetInstance().
+		Where("job_id = ?", jobUuid).
+		Updates(&JobRuntimeData{
+			JobID:      jobUuid,
+			Status:     JobStatusQueued,
+			QueuedTime: time.Now(),
+		}).Error
+}
+
+// Marks the job as exited, but only if it is still sitting in the queue (or paused, which is much the same thing)
+// Returns whether or not the job was actually dequeued
+func CancelQueuedJob(jobId string, reason string) (bool, error) {
+	jobUuid, err := uuid.Parse(jobId)
+	if err != nil {
+		return false, err
+	}
+
+	res := GetInstance().
+		Where("job_id = ? and status in ?", jobUuid, []string{JobStatusQueued, JobStatusPaused}).
+		Updates(&JobRuntimeData{
+			JobID:       jobUuid,
+			Status:      JobStatusExited,
+			StopReason:  reason,
+			StoppedTime: time.Now(),
+		})
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// Pauses the job, but only if it is still sitting in the queue
+// Returns whether or not the job was actually paused
+func PauseQueuedJob(jobId string) (bool, error) {
+	jobUuid, err := uuid.Parse(jobId)
+	if err != nil {
+		return false, err
+	}
+
+	res := GetInstance().
+		Where("job_id = ? and status = ?", jobUuid, JobStatusQueued).
+		Updates(&JobRuntimeData{
+			JobID:  jobUuid,
+			Status: JobStatusPaused,
+		})
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func SetJobMigrating(jobId string) error {
+	return GetInstance().
+		Table("job_runtime_data").
+		Where("job_id = ?", jobId).
+		Update("is_migrating", true).Error
+}
+
+func SetJobPausing(jobId string) error {
+	return GetInstance().
+		Table("job_runtime_data").
+		Where("job_id = ?", jobId).
+		Update("is_pausing", true).Error
+}
+
+// Jobs that should be paused, but that the agent hasn't paused yet
+func GetJobsToPauseForAgent(agentId string) ([]Job, error) {
+	jobs := []Job{}
+
+	err := GetInstance().
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("job_runtime_data.is_pausing = true and job_runtime_data.status in ? and jobs.assigned_agent_id = ?", []string{JobStatusAwaitingStart, JobStatusStarted}, agentId).
+		Find(&jobs).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// stopReason is why the job was paused, if it wasn't asked to, e.g. JobStopReasonThermalLimit
+func SetJobPaused(jobId string, stopReason string, restorePoint int64, pauseTime time.Time) error {
+	jobUuid, err := uuid.Parse(jobId)
+	if err != nil {
+		return err
+	}
+
+	return GetInstance().
+		Table("job_runtime_data").
+		Where("job_id = ?", jobUuid).
+		Updates(map[string]interface{}{
+			"status":        JobStatusPaused,
+			"stop_reason":   stopReason,
+			"stopped_time":  pauseTime,
+			"restore_point": gorm.Expr("greatest(restore_point, ?)", restorePoint),
+			"is_pausing":    false,
+		}).Error
+}
+
+// Puts a paused job back in the queue, with its params updated to only cover what's left to do
+// Returns whether or not the job was actually paused in the first place
+func ResumePausedJob(jobId string, params hashcattypes.HashcatParams) (bool, error) {
+	jobUuid, err := uuid.Parse(jobId)
+	if err != nil {
+		return false, err
+	}
+
+	resumed := false
+	err = GetInstance().Transaction(func(tx *gorm.DB) error {
+		res := tx.
+			Table("job_runtime_data").
+			Where("job_id = ? and status = ?", jobUuid, JobStatusPaused).
+			Updates(map[string]interface{}{
+				"status":       JobStatusQueued,
+				"stop_reason":  "",
+				"queued_time":  time.Now(),
+				"is_migrating": false,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		resumed = true
+
+		return tx.
+			Where("id = ?", jobUuid).
+			Updates(&Job{
+				HashcatParams: datatypes.NewJSONType(params),
+			}).Error
+	})
+
+	return resumed, err
+}
+
+// Puts a job that was lost along with its agent back in the queue, with its params updated to only cover what's left to do
+func RequeueRecoveredJob(jobId string, params hashcattypes.HashcatParams, reason string) error {
+	jobUuid, err := uuid.Parse(jobId)
+	if err != nil {
+		return err
+	}
+
+	return GetInstance().Transaction(func(tx *gorm.DB) error {
+		var current struct {
+			ErrorString string
+		}
+
+		err := tx.
+			Table("job_runtime_data").
+			Where("job_id = ?", jobId).
+			Find(&current).
+			Error
+
+		if err != nil {
+			return err
+		}
+
+		newErrStr := current.ErrorString
+		if newErrStr != "" {
+			newErrStr += "\n"
+		}
+		newErrStr += reason
+
+		err = tx.
+			Table("job_runtime_data").
+			Where("job_id = ?", jobUuid).
+			Updates(map[string]interface{}{
+				"status":         JobStatusQueued,
+				"queued_time":    time.Now(),
+				"error_string":   newErrStr,
+				"recovery_count": gorm.Expr("recovery_count + 1"),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Where("id = ?", jobUuid).
+			Updates(&Job{
+				HashcatParams: datatypes.NewJSONType(params),
+			}).Error
+	})
+}
+
+// devices is which of the agent's devices the job was given, nil for all of them
+func SetJobScheduled(jobId string, agentId string, devices []int) error {
 	jobUuid, err := uuid.Parse(jobId)
 	if err != nil {
 		return err
@@ -477,13 +858,16 @@ func SetJobScheduled(jobId string, agentId string) error {
 		}
 
 		return tx.
+			Model(&Job{}).
 			Where("id = ?", jobUuid).
-			Updates(&Job{
-				AssignedAgentID: &agentUuid,
+			Updates(map[string]interface{}{
+				"assigned_agent_id": agentUuid,
+				"assigned_devices":  deviceIDsToArray(devices),
 			}).Error
 	})
 }
 
+// Agents can send the same result more than once, which is fine: a hash that's already cracked (or already added as unexpected) is just updated again
 func AddJobCrackedHash(jobId string, hash string, plaintextHex string) error {
 	attemptedInsert := GetInstance().
 		Table("hashlist_hashes").
@@ -502,24 +886,13 @@ func AddJobCrackedHash(jobId string, hash string, plaintextHex string) error {
 	}
 
 	// this is a mystery hash we didn't know about!?
-	var result struct {
-		HashlistID uuid.UUID
-	}
-
-	err := GetInstance().
-		Table("jobs").
-		Select("hashlists.id as hashlist_id").
-		Joins("join attacks on attacks.id = jobs.attack_id").
-		Joins("join hashlists on hashlists.id = attacks.hashlist_id").
-		Where("jobs.id = ?", jobId).
-		Scan(&result).Error
-
+	hashlistId, err := getJobHashlistID(jobId)
 	if err != nil {
 		return err
 	}
 
 	newHash := &HashlistHash{
-		HashlistID:     result.HashlistID,
+		HashlistID:     hashlistId,
 		NormalizedHash: hash,
 		InputHash:      hash,
 		PlaintextHex:   plaintextHex,
@@ -530,6 +903,89 @@ func AddJobCrackedHash(jobId string, hash string, plaintextHex string) error {
 	return GetInstance().Save(newHash).Error
 }
 
+// The same as AddJobCrackedHash, but for a whole batch at once, which takes a couple of queries rather than a couple per hash
+func AddJobCrackedHashes(jobId string, results []hashcattypes.HashcatResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	hashes := make(pq.StringArray, len(results))
+	plaintexts := make(pq.StringArray, len(results))
+	for i, result := range results {
+		hashes[i] = result.Hash
+		plaintexts[i] = result.PlaintextHex
+	}
+
+	crackedHashes := []string{}
+	err := GetInstance().Raw(
+		"update hashlist_hashes set plaintext_hex = cracked.plaintext_hex, is_cracked = true from unnest(?::text[], ?::text[]) as cracked(normalized_hash, plaintext_hex) where hashlist_hashes.normalized_hash = cracked.normalized_hash returning hashlist_hashes.normalized_hash",
+		hashes, plaintexts,
+	).Scan(&crackedHashes).Error
+	if err != nil {
+		return err
+	}
+
+	// Anything that didn't update a hash is a mystery hash, same as above
+	seen := make(map[string]bool, len(crackedHashes))
+	for _, hash := range crackedHashes {
+		seen[hash] = true
+	}
+
+	newHashes := []HashlistHash{}
+	for _, result := range results {
+		if seen[result.Hash] {
+			continue
+		}
+		seen[result.Hash] = true
+
+		newHashes = append(newHashes, HashlistHash{
+			NormalizedHash: result.Hash,
+			InputHash:      result.Hash,
+			PlaintextHex:   result.PlaintextHex,
+			IsCracked:      true,
+			IsUnexpected:   true,
+		})
+	}
+
+	if len(newHashes) == 0 {
+		return nil
+	}
+
+	hashlistId, err := getJobHashlistID(jobId)
+	if err != nil {
+		return err
+	}
+
+	for i := range newHashes {
+		newHashes[i].HashlistID = hashlistId
+	}
+
+	return GetInstance().CreateInBatches(newHashes, 1000).Error
+}
+
+func getJobHashlistID(jobId string) (uuid.UUID, error) {
+	var result struct {
+		HashlistID uuid.UUID
+	}
+
+	query := GetInstance().
+		Table("jobs").
+		Select("hashlists.id as hashlist_id").
+		Joins("join attacks on attacks.id = jobs.attack_id").
+		Joins("join hashlists on hashlists.id = attacks.hashlist_id").
+		Where("jobs.id = ?", jobId).
+		Scan(&result)
+
+	if query.Error != nil {
+		return uuid.UUID{}, query.Error
+	}
+	if query.RowsAffected == 0 {
+		// The job (or its hashlist) is gone, so there's nowhere to put it
+		return uuid.UUID{}, ErrNotFound
+	}
+	return result.HashlistID, nil
+}
+
 // TODO: actually, on second thought, I want to keep all stderr lines, and only roll-over stdout lines
 const MaxJobOutputs = 10
 
@@ -547,8 +1003,8 @@ func AddJobStdline(jobId string, stream string, line string) error {
 
 func AddJobStatusUpdate(jobId string, status hashcattypes.HashcatStatus) error {
 	return GetInstance().Exec(
-		"update job_runtime_data set status_updates = array_append(status_updates[array_upper(status_updates, 1) - ?:], ?) where job_id = ?",
-		MaxJobOutputs-2, datatypes.NewJSONType(status), jobId,
+		"update job_runtime_data set status_updates = array_append(status_updates[array_upper(status_updates, 1) - ?:], ?), restore_point = ? where job_id = ?",
+		MaxJobOutputs-2, datatypes.NewJSONType(status), status.RestorePoint, jobId,
 	).Error
 }
 
@@ -581,7 +1037,7 @@ func GetJobsForAttack(attackId string, includeRuntimeData bool, includeTargetHas
 	}
 
 	if !includeTargetHashes {
-		query = query.Omit("TargetHashes")
+		query = query.Omit("TargetHashes", "AssociatedHints")
 	}
 
 	err := query.
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	"gorm.io/datatypes"
+)
+
+const (
+	// Working through its stages
+	AttackPipelineStatusRunning = "AttackPipelineStatus-Running"
+	// Ran out of stages, or cracked everything
+	AttackPipelineStatusFinished = "AttackPipelineStatus-Finished"
+	// User stopped it
+	AttackPipelineStatusStopped = "AttackPipelineStatus-Stopped"
+	// A stage couldn't be started
+	AttackPipelineStatusFailed = "AttackPipelineStatus-Failed"
+)
+
+type AttackPipelineStage struct {
+	HashcatParams        hashcattypes.HashcatParams `json:"hashcat_params"`
+	UseCrackedPlaintexts bool                       `json:"use_cracked_plaintexts"`
+}
+
+// An ordered list of attacks that are run one after the other against a hashlist
+type AttackPipeline struct {
+	UUIDBaseModel
+
+	Name          string
+	Stages        datatypes.JSONSlice[AttackPipelineStage]
+	IsDistributed bool
+
+	Status        string
+	StatusMessage string
+
+	CurrentStage    int
+	CurrentAttackID *uuid.UUID `gorm:"type:uuid"`
+
+	// The wordlist of cracked plaintexts generated for the current stage, if it uses one
+	GeneratedWordlistID *uuid.UUID `gorm:"type:uuid"`
+
+	HashlistID uuid.UUID `gorm:"type:uuid"`
+
+	CreatedByUser   User      `gorm:"constraint:OnDelete:SET NULL;"`
+	CreatedByUserID uuid.UUID `gorm:"type:uuid"`
+}
+
+func (p *AttackPipeline) ToDTO(attackIds []string) apitypes.AttackPipelineDTO {
+	stages := make([]apitypes.AttackPipelineStageDTO, len(p.Stages))
+	for i, stage := range p.Stages {
+		stages[i] = apitypes.AttackPipelineStageDTO{
+			HashcatParams:        stage.HashcatParams,
+			UseCrackedPlaintexts: stage.UseCrackedPlaintexts,
+		}
+	}
+
+	currentAttackId := ""
+	if p.CurrentAttackID != nil {
+		currentAttackId = p.CurrentAttackID.String()
+	}
+
+	if attackIds == nil {
+		attackIds = []string{}
+	}
+
+	return apitypes.AttackPipelineDTO{
+		ID:          p.ID.String(),
+		HashlistID:  p.HashlistID.String(),
+		Name:        p.Name,
+		TimeCreated: p.CreatedAt.Unix(),
+
+		Stages:        stages,
+		IsDistributed: p.IsDistributed,
+
+		Status:          p.Status,
+		StatusMessage:   p.StatusMessage,
+		CurrentStage:    p.CurrentStage,
+		CurrentAttackID: currentAttackId,
+		AttackIDs:       attackIds,
+
+		CreatedByUserID: p.CreatedByUserID.String(),
+	}
+}
+
+func CreateAttackPipeline(pipeline *AttackPipeline) (*AttackPipeline, error) {
+	return pipeline, GetInstance().Create(pipeline).Error
+}
+
+func GetAttackPipeline(id string) (*AttackPipeline, error) {
+	return GetByID[AttackPipeline](id)
+}
+
+func GetAllAttackPipelinesForHashlist(hashlistId string) ([]AttackPipeline, error) {
+	pipelines := []AttackPipeline{}
+	err := GetInstance().Order("created_at DESC").Find(&pipelines, "hashlist_id = ?", hashlistId).Error
+	if err != nil {
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+func GetAllRunningAttackPipelines() ([]AttackPipeline, error) {
+	pipelines := []AttackPipeline{}
+	err := GetInstance().Order("created_at ASC").Find(&pipelines, "status = ?", AttackPipelineStatusRunning).Error
+	if err != nil {
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+func GetAttackPipelineProjID(pipelineId string) (string, error) {
+	var result struct {
+		ProjectID uuid.UUID
+	}
+
+	err := GetInstance().
+		Table("attack_pipelines").
+		Select("hashlists.project_id as project_id").
+		Joins("join hashlists on hashlists.id = attack_pipelines.hashlist_id").
+		Where("attack_pipelines.id = ?", pipelineId).
+		Scan(&result).Error
+
+	if err != nil {
+		return "", err
+	}
+	return result.ProjectID.String(), nil
+}
+
+// Returns the IDs of the attacks each pipeline has started so far, oldest first
+func GetAttackIDsForPipelines(pipelineIds []string) (map[string][]string, error) {
+	results := []struct {
+		ID         uuid.UUID
+		PipelineID uuid.UUID
+	}{}
+
+	err := GetInstance().
+		Table("attacks").
+		Select("id, pipeline_id").
+		Where("pipeline_id in ? and deleted_at is null", pipelineIds).
+		Order("created_at ASC").
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	attackIds := make(map[string][]string, len(pipelineIds))
+	for _, result := range results {
+		attackIds[result.PipelineID.String()] = append(attackIds[result.PipelineID.String()], result.ID.String())
+	}
+	return attackIds, nil
+}
+
+// Only updates a pipeline that is still running, so a pipeline the user has stopped stays stopped
+func UpdateRunningAttackPipeline(pipelineId string, updates map[string]interface{}) (bool, error) {
+	res := GetInstance().
+		Table("attack_pipelines").
+		Where("id = ? and status = ?", pipelineId, AttackPipelineStatusRunning).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// An attack is done once none of its jobs are waiting to run or running, and there are no more chunks to hand out
+// Attacks that have been deleted count as done
+func IsAttackDone(attackId string) (bool, error) {
+	attack := &Attack{}
+	err := GetInstance().Unscoped().First(attack, "id = ?", attackId).Error
+	if err == ErrNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if attack.DeletedAt.Valid {
+		return true, nil
+	}
+
+	if attack.ChunkingActive || attack.IsPaused {
+		return false, nil
+	}
+
+	// The attack is still being split up into jobs
+	if attack.StartState == AttackStartStateStarting {
+		return false, nil
+	}
+
+	unfinishedJobs := int64(0)
+	err = GetInstance().
+		Table("jobs").
+		Joins("join job_runtime_data on job_runtime_data.job_id = jobs.id").
+		Where("jobs.attack_id = ? and jobs.deleted_at is null", attackId).
+		Where("job_runtime_data.status in ?", []string{JobStatusQueued, JobStatusAwaitingStart, JobStatusStarted, JobStatusPaused}).
+		Count(&unfinishedJobs).Error
+	if err != nil {
+		return false, err
+	}
+
+	return unfinishedJobs == 0, nil
+}
+
+func GetUncrackedHashCount(hashlistId string) (int64, error) {
+	count := int64(0)
+	err := GetInstance().
+		Table("hashlist_hashes").
+		Where("hashlist_id = ? and is_cracked = false", hashlistId).
+		Count(&count).Error
+	return count, err
+}
+
+// Returns the distinct plaintexts (hex encoded) of every cracked hash in the hashlist
+func GetCrackedPlaintextsForHashlist(hashlistId string) ([]string, error) {
+	plaintexts := []string{}
+	err := GetInstance().
+		Table("hashlist_hashes").
+		Distinct("plaintext_hex").
+		Where("hashlist_id = ? and is_cracked = true", hashlistId).
+		Pluck("plaintext_hex", &plaintexts).Error
+	if err != nil {
+		return nil, err
+	}
+	return plaintexts, nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
@@ -60,6 +61,54 @@ func AddPotfileEntry(newEntry *PotfileEntry) (*PotfileEntry, error) {
 	return newEntry, nil
 }
 
+// Adds whichever of the entries the potfile doesn't already have, in a couple of queries rather than a couple per entry
+func AddPotfileEntries(newEntries []PotfileEntry) error {
+	if len(newEntries) == 0 {
+		return nil
+	}
+
+	type entryKey struct {
+		hash         string
+		plaintextHex string
+		hashType     uint
+	}
+
+	hashes := make(pq.StringArray, len(newEntries))
+	for i, entry := range newEntries {
+		hashes[i] = entry.Hash
+	}
+
+	return GetInstance().Transaction(func(tx *gorm.DB) error {
+		foundEntries := []PotfileEntry{}
+		err := tx.Where("hash = any(?)", hashes).Find(&foundEntries).Error
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[entryKey]bool, len(foundEntries))
+		for _, entry := range foundEntries {
+			seen[entryKey{entry.Hash, entry.PlaintextHex, entry.HashType}] = true
+		}
+
+		// Same as AddPotfileEntry, a hash we've already got with a different plaintext is a collision, so it gets its own entry
+		entriesToCreate := []PotfileEntry{}
+		for _, entry := range newEntries {
+			key := entryKey{entry.Hash, entry.PlaintextHex, entry.HashType}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			entriesToCreate = append(entriesToCreate, entry)
+		}
+
+		if len(entriesToCreate) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entriesToCreate, 1000).Error
+	})
+}
+
 func SearchPotfile(hashes []string) ([]PotfileSearchResult, error) {
 	results := make([]PotfileSearchResult, 0)
 
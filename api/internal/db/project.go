@@ -1,11 +1,15 @@
 package db
 
 import (
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/lachlan2k/phatcrack/api/internal/roles"
 	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
@@ -22,6 +26,11 @@ type Project struct {
 	OwnerUserID uuid.UUID `gorm:"type:uuid"`
 
 	ProjectShare []ProjectShare `gorm:"constraint:OnDelete:CASCADE;"`
+
+	// Applies to every attack in the project, on top of whatever the attack asks for itself
+	AgentPlacement AgentPlacement `gorm:"embedded"`
+	// If set, the project's jobs only run on this pool, and take precedence over the owner's pool
+	AgentPoolID *uuid.UUID `gorm:"type:uuid"`
 }
 
 func (p *Project) ToDTO() apitypes.ProjectDTO {
@@ -31,6 +40,9 @@ func (p *Project) ToDTO() apitypes.ProjectDTO {
 		Name:        p.Name,
 		Description: p.Description,
 		OwnerUserID: p.OwnerUserID.String(),
+
+		AgentPlacement: p.AgentPlacement.ToDTO(),
+		AgentPoolID:    agentPoolIDToString(p.AgentPoolID),
 	}
 }
 
@@ -88,6 +100,9 @@ type Hashlist struct {
 	Hashes       []HashlistHash `gorm:"constraint:OnDelete:CASCADE;"`
 	HasUsernames bool
 
+	// Free-form labels, used to pick out hashlists for scheduled attacks
+	Tags pq.StringArray `gorm:"type:text[]"`
+
 	Attacks []Attack `gorm:"constraint:OnDelete:CASCADE;"`
 }
 
@@ -100,6 +115,11 @@ func (h *Hashlist) ToDTO(withHashes bool) apitypes.HashlistDTO {
 		}
 	}
 
+	tags := []string(h.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
 	return apitypes.HashlistDTO{
 		ID:           h.ID.String(),
 		ProjectID:    h.ProjectID.String(),
@@ -109,6 +129,7 @@ func (h *Hashlist) ToDTO(withHashes bool) apitypes.HashlistDTO {
 		Hashes:       hashes,
 		Version:      h.Version,
 		HasUsernames: h.HasUsernames,
+		Tags:         tags,
 	}
 }
 
@@ -202,27 +223,198 @@ func (h *HashlistHash) ToDTO() apitypes.HashlistHashDTO {
 	}
 }
 
+const (
+	// Being split up into jobs, which are about to be queued
+	AttackStartStateStarting = "AttackStartState-Starting"
+	// Its jobs (or chunks) are queued
+	AttackStartStateStarted = "AttackStartState-Started"
+	// Couldn't be started, or the API was stopped part way through starting it
+	AttackStartStateFailed = "AttackStartState-Failed"
+)
+
 type Attack struct {
 	UUIDBaseModel
 	HashcatParams  datatypes.JSONType[hashcattypes.HashcatParams]
 	IsDistributed  bool
 	ProgressString string
+	// How far StartAttack got the last time the attack was started, empty if it never has been
+	StartState string
+
+	// Higher priority attacks get their jobs dispatched first
+	Priority int `gorm:"default:0; not null"`
+
+	IsPaused bool
+
+	// Chunked attacks have their keyspace handed out a chunk at a time as agents free up, rather than all at once
+	IsChunked      bool
+	ChunkingActive bool
+	Keyspace       int64
+	ChunkSize      int64
+	NextChunkSkip  int64
+
+	// Set if the attack was started as a stage of a pipeline
+	PipelineID *uuid.UUID `gorm:"type:uuid"`
+
+	Limits AttackLimits `gorm:"embedded"`
+	// Which agents the attack's jobs may be given to, in addition to the project's placement
+	AgentPlacement AgentPlacement `gorm:"embedded"`
+	// When the attack was last started, which the runtime limit is measured from
+	StartedAt *time.Time
+	// The clock is stopped while the attack is paused, so time spent paused doesn't count against the runtime limit
+	PausedAt      *time.Time
+	PausedSeconds int64 `gorm:"default:0; not null"`
+	// Why the attack was stopped by one of its limits, if it was
+	LimitStopMessage string
 
 	Jobs       []Job     `gorm:"constraint:OnDelete:CASCADE;"`
 	HashlistID uuid.UUID `gorm:"type:uuid"`
 }
 
+// Conditions for stopping an attack before it runs to completion. 0 means no limit
+type AttackLimits struct {
+	MaxRuntimeMinutes                int
+	MaxEstimatedTimeRemainingMinutes int
+	StopAtCrackedPercent             int
+}
+
+func (l AttackLimits) IsSet() bool {
+	return l.MaxRuntimeMinutes > 0 || l.MaxEstimatedTimeRemainingMinutes > 0 || l.StopAtCrackedPercent > 0
+}
+
+func (l AttackLimits) ToDTO() apitypes.AttackLimitsDTO {
+	return apitypes.AttackLimitsDTO{
+		MaxRuntimeMinutes:                l.MaxRuntimeMinutes,
+		MaxEstimatedTimeRemainingMinutes: l.MaxEstimatedTimeRemainingMinutes,
+		StopAtCrackedPercent:             l.StopAtCrackedPercent,
+	}
+}
+
+func AttackLimitsFromDTO(dto apitypes.AttackLimitsDTO) AttackLimits {
+	return AttackLimits{
+		MaxRuntimeMinutes:                dto.MaxRuntimeMinutes,
+		MaxEstimatedTimeRemainingMinutes: dto.MaxEstimatedTimeRemainingMinutes,
+		StopAtCrackedPercent:             dto.StopAtCrackedPercent,
+	}
+}
+
+// Which agents work may be given to, based on the labels an admin has put on them
+// An agent has to have every required label, and none of the forbidden ones
+type AgentPlacement struct {
+	RequiredAgentLabels  pq.StringArray `gorm:"type:text[]"`
+	ForbiddenAgentLabels pq.StringArray `gorm:"type:text[]"`
+}
+
+func (p AgentPlacement) IsSet() bool {
+	return len(p.RequiredAgentLabels) > 0 || len(p.ForbiddenAgentLabels) > 0
+}
+
+func (p AgentPlacement) Allows(agent Agent) bool {
+	for _, label := range p.RequiredAgentLabels {
+		if !slices.Contains(agent.Labels, label) {
+			return false
+		}
+	}
+	for _, label := range p.ForbiddenAgentLabels {
+		if slices.Contains(agent.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// Combines two placements, so that an agent has to satisfy both
+func (p AgentPlacement) Merge(other AgentPlacement) AgentPlacement {
+	merged := AgentPlacement{}
+	for _, label := range slices.Concat(p.RequiredAgentLabels, other.RequiredAgentLabels) {
+		if !slices.Contains(merged.RequiredAgentLabels, label) {
+			merged.RequiredAgentLabels = append(merged.RequiredAgentLabels, label)
+		}
+	}
+	for _, label := range slices.Concat(p.ForbiddenAgentLabels, other.ForbiddenAgentLabels) {
+		if !slices.Contains(merged.ForbiddenAgentLabels, label) {
+			merged.ForbiddenAgentLabels = append(merged.ForbiddenAgentLabels, label)
+		}
+	}
+	return merged
+}
+
+func (p AgentPlacement) ToDTO() apitypes.AgentPlacementDTO {
+	required := []string(p.RequiredAgentLabels)
+	if required == nil {
+		required = []string{}
+	}
+	forbidden := []string(p.ForbiddenAgentLabels)
+	if forbidden == nil {
+		forbidden = []string{}
+	}
+
+	return apitypes.AgentPlacementDTO{
+		RequiredAgentLabels:  required,
+		ForbiddenAgentLabels: forbidden,
+	}
+}
+
+func AgentPlacementFromDTO(dto apitypes.AgentPlacementDTO) AgentPlacement {
+	return AgentPlacement{
+		RequiredAgentLabels:  dto.RequiredAgentLabels,
+		ForbiddenAgentLabels: dto.ForbiddenAgentLabels,
+	}
+}
+
 func CreateAttack(attack *Attack) (*Attack, error) {
 	return attack, GetInstance().Create(attack).Error
 }
 
+// Creates all of the attacks, or none of them
+func CreateAttacks(attacks []*Attack) error {
+	return GetInstance().Create(attacks).Error
+}
+
+// How long the attack has been running since it was last started, not counting any time it spent paused
+func (a *Attack) Runtime() time.Duration {
+	if a.StartedAt == nil {
+		return 0
+	}
+
+	until := time.Now()
+	if a.PausedAt != nil {
+		until = *a.PausedAt
+	}
+	return until.Sub(*a.StartedAt) - time.Duration(a.PausedSeconds)*time.Second
+}
+
 func (a *Attack) ToDTO() apitypes.AttackDTO {
+	pipelineId := ""
+	if a.PipelineID != nil {
+		pipelineId = a.PipelineID.String()
+	}
+
+	var startedAt int64 = 0
+	if a.StartedAt != nil {
+		startedAt = a.StartedAt.Unix()
+	}
+
 	return apitypes.AttackDTO{
 		ID:             a.ID.String(),
 		HashlistID:     a.HashlistID.String(),
 		HashcatParams:  a.HashcatParams.Data(),
 		IsDistributed:  a.IsDistributed,
 		ProgressString: a.ProgressString,
+		Priority:       a.Priority,
+		IsPaused:       a.IsPaused,
+
+		IsChunked:          a.IsChunked,
+		ChunkingActive:     a.ChunkingActive,
+		Keyspace:           a.Keyspace,
+		KeyspaceDispatched: a.NextChunkSkip,
+
+		PipelineID: pipelineId,
+
+		Limits:           a.Limits.ToDTO(),
+		StartedAt:        startedAt,
+		LimitStopMessage: a.LimitStopMessage,
+
+		AgentPlacement: a.AgentPlacement.ToDTO(),
 	}
 }
 
@@ -328,6 +520,19 @@ func GetAllHashlistsForProject(projId string) ([]Hashlist, error) {
 	return hashlists, err
 }
 
+func SetHashlistTags(hashlistId string, tags []string) error {
+	return GetInstance().Model(&Hashlist{}).Where("id = ?", hashlistId).Update("tags", pq.StringArray(tags)).Error
+}
+
+func GetAllHashlistsWithTag(tag string) ([]Hashlist, error) {
+	hashlists := []Hashlist{}
+	err := GetInstance().Order("created_at ASC").Find(&hashlists, "? = any(tags)", tag).Error
+	if err != nil {
+		return nil, err
+	}
+	return hashlists, nil
+}
+
 func GetAttack(attackId string) (*Attack, error) {
 	var attack Attack
 	err := GetInstance().First(&attack, "id = ?", attackId).Error
@@ -359,6 +564,15 @@ func DeleteProject(projectId string) error {
 			return err
 		}
 
+		// Pipelines
+		err = tx.
+			Joins("join hashlists on hashlists.id = attack_pipelines.hashlist_id").
+			Where("hashlists.project_id = ?", projectId).
+			Delete(&AttackPipeline{}).Error
+		if err != nil {
+			return err
+		}
+
 		// Hashlists
 		err = tx.Where("project_id = ?", projectId).Delete(&Hashlist{}).Error
 		if err != nil {
@@ -388,6 +602,12 @@ func DeleteHashlist(hashlistId string) error {
 			return err
 		}
 
+		// Pipelines
+		err = tx.Where("hashlist_id = ?", hashlistId).Delete(&AttackPipeline{}).Error
+		if err != nil {
+			return err
+		}
+
 		// Hashlist
 		return tx.Delete(&Hashlist{}, hashlistId).Error
 	})
@@ -471,6 +691,293 @@ func GetAllAttacksWithProgressStringsForUser(user *User) ([]AttackIDTree, error)
 	return attacks, err
 }
 
+func SetAttackLimits(attackId string, limits AttackLimits) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Updates(map[string]interface{}{
+			"max_runtime_minutes":                  limits.MaxRuntimeMinutes,
+			"max_estimated_time_remaining_minutes": limits.MaxEstimatedTimeRemainingMinutes,
+			"stop_at_cracked_percent":              limits.StopAtCrackedPercent,
+		}).Error
+}
+
+func SetAttackAgentPlacement(attackId string, placement AgentPlacement) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Updates(map[string]interface{}{
+			"required_agent_labels":  placement.RequiredAgentLabels,
+			"forbidden_agent_labels": placement.ForbiddenAgentLabels,
+		}).Error
+}
+
+func SetProjectAgentPlacement(projectId string, placement AgentPlacement) error {
+	return GetInstance().
+		Table("projects").
+		Where("id = ?", projectId).
+		Updates(map[string]interface{}{
+			"required_agent_labels":  placement.RequiredAgentLabels,
+			"forbidden_agent_labels": placement.ForbiddenAgentLabels,
+		}).Error
+}
+
+// Starts the clock on the attack's runtime limit, clears the reason it was last stopped by a limit, and marks it as starting
+func MarkAttackStarted(attackId string) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Updates(map[string]interface{}{
+			"started_at":         time.Now(),
+			"paused_at":          nil,
+			"paused_seconds":     0,
+			"limit_stop_message": "",
+			"start_state":        AttackStartStateStarting,
+		}).Error
+}
+
+func SetAttackStartState(attackId string, startState string) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Update("start_state", startState).Error
+}
+
+// Nothing can still be starting when the API has just come up, so anything that says it is was interrupted
+func FailInterruptedAttackStarts() (int64, error) {
+	res := GetInstance().
+		Table("attacks").
+		Where("start_state = ?", AttackStartStateStarting).
+		Updates(map[string]interface{}{
+			"start_state":     AttackStartStateFailed,
+			"progress_string": "Interrupted while starting",
+		})
+	return res.RowsAffected, res.Error
+}
+
+func SetAttackLimitStopMessage(attackId string, message string) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Update("limit_stop_message", message).Error
+}
+
+// Of the given attacks, gets those which have a limit set and haven't already been stopped by one
+func GetAttacksWithLimits(attackIds []string) ([]Attack, error) {
+	attacks := []Attack{}
+	err := GetInstance().
+		Where("id in ?", attackIds).
+		Where("max_runtime_minutes > 0 OR max_estimated_time_remaining_minutes > 0 OR stop_at_cracked_percent > 0").
+		Where("limit_stop_message = ''").
+		Find(&attacks).Error
+	if err != nil {
+		return nil, err
+	}
+	return attacks, nil
+}
+
+func GetHashlistCrackedPercent(hashlistId string) (float64, error) {
+	var result struct {
+		Total   int64
+		Cracked int64
+	}
+
+	err := GetInstance().
+		Table("hashlist_hashes").
+		Select("count(*) as total, count(*) filter (where is_cracked) as cracked").
+		Where("hashlist_id = ?", hashlistId).
+		Scan(&result).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Total == 0 {
+		return 0, nil
+	}
+	return float64(result.Cracked) * 100 / float64(result.Total), nil
+}
+
+func SetAttackPriority(attackId string, priority int) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Update("priority", priority).Error
+}
+
+// What the dispatcher needs to know about an attack to decide whose turn it is, and who may have it
+type AttackSchedulingInfo struct {
+	AttackID      string
+	Priority      int
+	OwnerUsername string
+
+	// The attack's placement combined with its project's, and the pool the project (or its owner) is in
+	AgentConstraints AgentConstraints
+}
+
+func GetAttackSchedulingInfo(attackIds []string) (map[string]AttackSchedulingInfo, error) {
+	results := []struct {
+		AttackID      string
+		Priority      int
+		OwnerUsername string
+		AgentPoolID   *uuid.UUID
+
+		AttackRequiredAgentLabels   pq.StringArray
+		AttackForbiddenAgentLabels  pq.StringArray
+		ProjectRequiredAgentLabels  pq.StringArray
+		ProjectForbiddenAgentLabels pq.StringArray
+	}{}
+
+	err := GetInstance().
+		Table("attacks").
+		Select(
+			"attacks.id as attack_id, attacks.priority as priority, coalesce(users.username, '') as owner_username, "+
+				"coalesce(projects.agent_pool_id, users.agent_pool_id) as agent_pool_id, "+
+				"attacks.required_agent_labels as attack_required_agent_labels, attacks.forbidden_agent_labels as attack_forbidden_agent_labels, "+
+				"projects.required_agent_labels as project_required_agent_labels, projects.forbidden_agent_labels as project_forbidden_agent_labels",
+		).
+		Joins("join hashlists on hashlists.id = attacks.hashlist_id").
+		Joins("join projects on projects.id = hashlists.project_id").
+		// The owner may have been deleted, which mustn't lose the project's own constraints
+		Joins("left join users on users.id = projects.owner_user_id").
+		Where("attacks.id in ?", attackIds).
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]AttackSchedulingInfo, len(results))
+	for _, result := range results {
+		attackPlacement := AgentPlacement{
+			RequiredAgentLabels:  result.AttackRequiredAgentLabels,
+			ForbiddenAgentLabels: result.AttackForbiddenAgentLabels,
+		}
+		projectPlacement := AgentPlacement{
+			RequiredAgentLabels:  result.ProjectRequiredAgentLabels,
+			ForbiddenAgentLabels: result.ProjectForbiddenAgentLabels,
+		}
+
+		infos[result.AttackID] = AttackSchedulingInfo{
+			AttackID:      result.AttackID,
+			Priority:      result.Priority,
+			OwnerUsername: result.OwnerUsername,
+			AgentConstraints: AgentConstraints{
+				Placement:   attackPlacement.Merge(projectPlacement),
+				AgentPoolID: result.AgentPoolID,
+			},
+		}
+	}
+	return infos, nil
+}
+
+// Which agents an attack's jobs may go to, taking into account its project and the project's owner
+func GetAttackAgentConstraints(attackId string) (AgentConstraints, error) {
+	infos, err := GetAttackSchedulingInfo([]string{attackId})
+	if err != nil {
+		return AgentConstraints{}, err
+	}
+	info, ok := infos[attackId]
+	if !ok {
+		return AgentConstraints{}, ErrNotFound
+	}
+	return info.AgentConstraints, nil
+}
+
+func StartAttackChunking(attackId string, keyspace int64, chunkSize int64) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Updates(map[string]interface{}{
+			"is_chunked":      true,
+			"chunking_active": true,
+			"keyspace":        keyspace,
+			"chunk_size":      chunkSize,
+			"next_chunk_skip": 0,
+		}).Error
+}
+
+func StopAttackChunking(attackId string) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Updates(map[string]interface{}{
+			"chunking_active": false,
+			"is_paused":       false,
+		}).Error
+}
+
+// Marks the attack as paused, and stops any more chunks being handed out until it is resumed
+func SetAttackPaused(attackId string) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ?", attackId).
+		Updates(map[string]interface{}{
+			"chunking_active": false,
+			"is_paused":       true,
+			// Pausing again shouldn't restart the clock's pause
+			"paused_at": gorm.Expr("coalesce(paused_at, ?)", time.Now()),
+		}).Error
+}
+
+// Unpauses the attack, and picks up handing out chunks if there are any left
+func SetAttackResumed(attackId string) error {
+	return GetInstance().
+		Table("attacks").
+		Where("id = ? and is_paused = true", attackId).
+		Updates(map[string]interface{}{
+			"chunking_active": gorm.Expr("is_chunked and next_chunk_skip < keyspace"),
+			"is_paused":       false,
+			// Start the clock again, leaving out the time spent paused
+			"paused_seconds": gorm.Expr("paused_seconds + coalesce(extract(epoch from ?::timestamptz - paused_at), 0)::bigint", time.Now()),
+			"paused_at":      nil,
+		}).Error
+}
+
+// Claims the next chunk of the attack's keyspace. ok is false if there is nothing left to hand out
+// A limit of 0 means the chunk runs to the end of the keyspace
+func ClaimNextAttackChunk(attackId string) (skip int64, limit int64, ok bool, err error) {
+	err = GetInstance().Transaction(func(tx *gorm.DB) error {
+		attack := &Attack{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(attack, "id = ?", attackId).Error
+		if err != nil {
+			return err
+		}
+
+		if !attack.ChunkingActive || attack.NextChunkSkip >= attack.Keyspace {
+			return nil
+		}
+
+		skip = attack.NextChunkSkip
+		limit = attack.ChunkSize
+		nextSkip := skip + limit
+		if nextSkip >= attack.Keyspace {
+			// Final chunk
+			limit = 0
+			nextSkip = attack.Keyspace
+		}
+		ok = true
+
+		return tx.
+			Table("attacks").
+			Where("id = ?", attackId).
+			Updates(map[string]interface{}{
+				"next_chunk_skip": nextSkip,
+				"chunking_active": nextSkip < attack.Keyspace,
+			}).Error
+	})
+
+	return
+}
+
+// Returns the chunked attacks that still have keyspace to hand out, oldest first
+func GetAllActiveChunkedAttacks() ([]Attack, error) {
+	attacks := []Attack{}
+	err := GetInstance().Order("created_at ASC").Find(&attacks, "is_chunked = true and chunking_active = true").Error
+	if err != nil {
+		return nil, err
+	}
+	return attacks, nil
+}
+
 func SetAttackProgressString(attackId string, progressString string) error {
 	return GetInstance().
 		Table("attacks").
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	// Everything the schedule asked for was started
+	AttackScheduleOutcomeStarted = "AttackScheduleOutcome-Started"
+	// There was nothing to do, e.g. every hash was already cracked
+	AttackScheduleOutcomeSkipped = "AttackScheduleOutcome-Skipped"
+	// Some or all of the attacks couldn't be created or started
+	AttackScheduleOutcomeFailed = "AttackScheduleOutcome-Failed"
+)
+
+// Starts attacks at a set time, and optionally keeps doing so on an interval
+// A schedule either starts an existing attack, or runs a template (or template set) against every hashlist with a tag
+type AttackSchedule struct {
+	UUIDBaseModel
+
+	Name string
+
+	AttackID *uuid.UUID `gorm:"type:uuid"`
+
+	AttackTemplateID *uuid.UUID `gorm:"type:uuid"`
+	HashlistTag      string
+	IsDistributed    bool
+
+	IsEnabled bool
+	NextRunAt time.Time `gorm:"index"`
+	// 0 means the schedule only runs once
+	RepeatIntervalMinutes int
+
+	LastRunAt   *time.Time
+	LastOutcome string
+
+	CreatedByUser   User      `gorm:"constraint:OnDelete:SET NULL;"`
+	CreatedByUserID uuid.UUID `gorm:"type:uuid"`
+}
+
+// A record of what happened each time a schedule ran
+type AttackScheduleRun struct {
+	UUIDBaseModel
+
+	AttackScheduleID uuid.UUID `gorm:"type:uuid;index"`
+	Outcome          string
+	Message          string
+	AttackIDs        pq.StringArray `gorm:"type:text[]"`
+}
+
+func (s *AttackSchedule) ToDTO() apitypes.AttackScheduleDTO {
+	attackId := ""
+	if s.AttackID != nil {
+		attackId = s.AttackID.String()
+	}
+
+	attackTemplateId := ""
+	if s.AttackTemplateID != nil {
+		attackTemplateId = s.AttackTemplateID.String()
+	}
+
+	var lastRunAt int64 = 0
+	if s.LastRunAt != nil {
+		lastRunAt = s.LastRunAt.Unix()
+	}
+
+	return apitypes.AttackScheduleDTO{
+		ID:          s.ID.String(),
+		Name:        s.Name,
+		TimeCreated: s.CreatedAt.Unix(),
+
+		AttackID:         attackId,
+		AttackTemplateID: attackTemplateId,
+		HashlistTag:      s.HashlistTag,
+		IsDistributed:    s.IsDistributed,
+
+		IsEnabled:             s.IsEnabled,
+		NextRunAt:             s.NextRunAt.Unix(),
+		RepeatIntervalMinutes: s.RepeatIntervalMinutes,
+
+		LastRunAt:   lastRunAt,
+		LastOutcome: s.LastOutcome,
+
+		CreatedByUserID: s.CreatedByUserID.String(),
+	}
+}
+
+func (r *AttackScheduleRun) ToDTO() apitypes.AttackScheduleRunDTO {
+	attackIds := []string(r.AttackIDs)
+	if attackIds == nil {
+		attackIds = []string{}
+	}
+
+	return apitypes.AttackScheduleRunDTO{
+		ID:               r.ID.String(),
+		AttackScheduleID: r.AttackScheduleID.String(),
+		TimeRan:          r.CreatedAt.Unix(),
+		Outcome:          r.Outcome,
+		Message:          r.Message,
+		AttackIDs:        attackIds,
+	}
+}
+
+func CreateAttackSchedule(schedule *AttackSchedule) (*AttackSchedule, error) {
+	return schedule, GetInstance().Create(schedule).Error
+}
+
+func GetAttackSchedule(id string) (*AttackSchedule, error) {
+	return GetByID[AttackSchedule](id)
+}
+
+func GetAllAttackSchedules() ([]AttackSchedule, error) {
+	schedules := []AttackSchedule{}
+	err := GetInstance().Order("next_run_at ASC").Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func GetAllAttackSchedulesForUser(userId string) ([]AttackSchedule, error) {
+	schedules := []AttackSchedule{}
+	err := GetInstance().Order("next_run_at ASC").Find(&schedules, "created_by_user_id = ?", userId).Error
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func GetAllDueAttackSchedules() ([]AttackSchedule, error) {
+	schedules := []AttackSchedule{}
+	err := GetInstance().Order("next_run_at ASC").Find(&schedules, "is_enabled = true AND next_run_at <= ?", time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// Marks the schedule as run, moving it on to its next run (or disabling it, if it only runs once)
+// Only succeeds if nobody else has claimed this run first, so a run can't happen twice
+func ClaimAttackScheduleRun(schedule *AttackSchedule) (bool, error) {
+	now := time.Now()
+
+	updates := map[string]interface{}{
+		"last_run_at": now,
+	}
+
+	if schedule.RepeatIntervalMinutes > 0 {
+		// Skip past any runs we missed while we were down, rather than running them all back to back
+		interval := time.Duration(schedule.RepeatIntervalMinutes) * time.Minute
+		nextRunAt := schedule.NextRunAt
+		for !nextRunAt.After(now) {
+			nextRunAt = nextRunAt.Add(interval)
+		}
+		updates["next_run_at"] = nextRunAt
+	} else {
+		updates["is_enabled"] = false
+	}
+
+	res := GetInstance().
+		Model(&AttackSchedule{}).
+		Where("id = ? AND is_enabled = true AND next_run_at = ?", schedule.ID, schedule.NextRunAt).
+		Updates(updates)
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func SetAttackScheduleEnabled(id string, enabled bool) error {
+	return GetInstance().Model(&AttackSchedule{}).Where("id = ?", id).Update("is_enabled", enabled).Error
+}
+
+func CreateAttackScheduleRun(run *AttackScheduleRun) error {
+	return GetInstance().Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(run).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&AttackSchedule{}).Where("id = ?", run.AttackScheduleID).Update("last_outcome", run.Outcome).Error
+	})
+}
+
+func GetAttackScheduleRuns(scheduleId string, limit int) ([]AttackScheduleRun, error) {
+	runs := []AttackScheduleRun{}
+	err := GetInstance().Order("created_at DESC").Limit(limit).Find(&runs, "attack_schedule_id = ?", scheduleId).Error
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Also deletes the record of its runs
+func DeleteAttackSchedule(id string) error {
+	return GetInstance().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("attack_schedule_id = ?", id).Delete(&AttackScheduleRun{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&AttackSchedule{}, "id = ?", id).Error
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/lachlan2k/phatcrack/api/internal/util"
 	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
 	"golang.org/x/crypto/bcrypt"
@@ -21,6 +22,9 @@ type User struct {
 
 	MFAType string
 	MFAData datatypes.JSON
+
+	// If set, projects owned by the user run on this pool, unless the project has its own
+	AgentPoolID *uuid.UUID `gorm:"type:uuid"`
 }
 
 func (u *User) ToDTO() apitypes.UserDTO {
@@ -37,6 +41,7 @@ func (u *User) ToAdminDTO() apitypes.AdminGetUserDTO {
 		Username:         u.Username,
 		Roles:            u.Roles,
 		IsPasswordLocked: u.IsPasswordLocked(),
+		AgentPoolID:      agentPoolIDToString(u.AgentPoolID),
 	}
 }
 
@@ -21,6 +21,10 @@ type AgentConnection struct {
 	conn      *websocket.Conn
 	writeLock sync.Mutex
 	agentId   string
+
+	// Benchmarks we've asked for but haven't had the result of, no jobs are given to the agent until they're done
+	// Guarded by fleetLock
+	pendingBenchmarks int
 }
 
 // Should only be called by Handle()
@@ -46,19 +50,29 @@ func (a *AgentConnection) markDisconnected() {
 }
 
 func (a *AgentConnection) handleMessage(msg *wstypes.Message) error {
+	// Cracked hashes only touch the database, and can take a while to store when they come thick and fast
+	// So they don't hold up the rest of the fleet by taking the lock
+	switch msg.Type {
+	case wstypes.JobCrackedHashType:
+		return a.handleJobCrackedHash(msg)
+
+	case wstypes.JobCrackedHashBatchType:
+		return a.handleJobCrackedHashBatch(msg)
+	}
+
 	fleetLock.Lock()
 	defer fleetLock.Unlock()
 
 	switch msg.Type {
+	case wstypes.AgentHelloType:
+		return a.handleAgentHello(msg)
+
 	case wstypes.HeartbeatType:
 		return a.handleHeartbeat(msg)
 
 	case wstypes.JobStartedType:
 		return a.handleJobStarted(msg)
 
-	case wstypes.JobCrackedHashType:
-		return a.handleJobCrackedHash(msg)
-
 	case wstypes.JobStdLineType:
 		return a.handleJobStdLine(msg)
 
@@ -71,6 +85,12 @@ func (a *AgentConnection) handleMessage(msg *wstypes.Message) error {
 	case wstypes.JobFailedToStartType:
 		return a.handleJobFailedToStart(msg)
 
+	case wstypes.BenchmarkResultType:
+		return a.handleBenchmarkResult(msg)
+
+	case wstypes.ThermalEventType:
+		return a.handleThermalEvent(msg)
+
 	default:
 		return fmt.Errorf("unrecognized message type: %q", msg.Type)
 	}
@@ -95,6 +115,44 @@ func (a *AgentConnection) sendMessage(msgType string, payload interface{}) error
 	})
 }
 
+func (a *AgentConnection) handleAgentHello(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.AgentHelloDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to agent hello dto: %w", msg.Payload, err)
+	}
+
+	logger := log.WithField("agent_id", a.agentId)
+	for _, agentErr := range payload.Errors {
+		logger.WithField("error", agentErr).Warn("Agent had trouble working out its capabilities")
+	}
+
+	err = db.UpdateAgentCapabilities(a.agentId, db.AgentCapabilities{
+		HashcatVersion:     payload.HashcatVersion,
+		OS:                 payload.OS,
+		Arch:               payload.Arch,
+		Devices:            payload.Devices,
+		SupportedHashTypes: payload.SupportedHashTypes,
+		ListfileDiskFree:   payload.ListfileDiskFree,
+		Errors:             payload.Errors,
+		TimeReported:       time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The agent forgets any overrides when it restarts, so it's sent them every time it connects
+	agent, err := db.GetAgent(a.agentId)
+	if err != nil {
+		return err
+	}
+	err = a.sendThermalPolicy(agent.ThermalPolicy.Data())
+	if err != nil {
+		return err
+	}
+
+	return a.handleRecoverableJobsUnsafe(payload.RecoverableJobs)
+}
+
 func (a *AgentConnection) handleHeartbeat(msg *wstypes.Message) error {
 	payload, err := util.UnmarshalJSON[wstypes.HeartbeatDTO](msg.Payload)
 	if err != nil {
@@ -102,6 +160,8 @@ func (a *AgentConnection) handleHeartbeat(msg *wstypes.Message) error {
 	}
 
 	defer LazyQueueStateReconciliation()
+	// The agent might've just become healthy, so it could be able to take on queued work
+	defer QueueDispatch()
 
 	availableListfiles := make([]db.AgentFile, len(payload.Listfiles))
 	listfilesToCheckMap := make(map[string]*db.AgentFile)
@@ -120,6 +180,7 @@ func (a *AgentConnection) handleHeartbeat(msg *wstypes.Message) error {
 		TimeOfLastHeartbeat: time.Now(),
 		AvailableListfiles:  availableListfiles,
 		ActiveJobIDs:        payload.ActiveJobIDs,
+		MaxConcurrentJobs:   payload.MaxConcurrentJobs,
 	}
 
 	err = db.UpdateAgentInfo(a.agentId, info)
@@ -128,6 +189,12 @@ func (a *AgentConnection) handleHeartbeat(msg *wstypes.Message) error {
 		return err
 	}
 
+	// Covers pauses we couldn't send while the agent was disconnected
+	err = a.resendJobPausesUnsafe()
+	if err != nil {
+		return err
+	}
+
 	if !config.Get().Agent.AutomaticallySyncListfiles {
 		return nil
 	}
@@ -175,6 +242,42 @@ func (a *AgentConnection) handleHeartbeat(msg *wstypes.Message) error {
 	return nil
 }
 
+func (a *AgentConnection) handleBenchmarkResult(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.BenchmarkResultDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to benchmark result dto: %w", msg.Payload, err)
+	}
+
+	logger := log.WithField("agent_id", a.agentId).WithField("hash_type", payload.HashType)
+
+	if a.pendingBenchmarks > 0 {
+		a.pendingBenchmarks--
+		if a.pendingBenchmarks == 0 {
+			// The agent's devices are free for jobs again
+			QueueDispatch()
+		}
+	}
+
+	hashrate := int64(0)
+	for _, device := range payload.Devices {
+		hashrate += device.Speed
+	}
+
+	if payload.Error != "" {
+		logger.WithField("error", payload.Error).Warn("Agent failed to run benchmark")
+	} else {
+		logger.WithField("hashrate", hashrate).Info("Agent finished benchmark")
+	}
+
+	return db.UpdateAgentBenchmark(a.agentId, db.AgentBenchmark{
+		HashType: payload.HashType,
+		Hashrate: hashrate,
+		Devices:  payload.Devices,
+		Time:     payload.Time,
+		Error:    payload.Error,
+	})
+}
+
 func (a *AgentConnection) RequestFileDownload(fileIDs ...uuid.UUID) error {
 	fileIDStrs := make([]string, len(fileIDs))
 	for i, id := range fileIDs {
@@ -0,0 +1,99 @@
+package fleet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// Hashcat's estimate is all over the place while it warms up, so we give jobs a while before trusting it
+const estimateSettleTime = 2 * time.Minute
+
+// Works out whether the attack has gone over one of its limits, returning why if it has
+func attackLimitExceeded(attack db.Attack, jobs []db.Job) (string, error) {
+	limits := attack.Limits
+
+	if limits.MaxRuntimeMinutes > 0 && attack.StartedAt != nil {
+		maxRuntime := time.Duration(limits.MaxRuntimeMinutes) * time.Minute
+		if attack.Runtime() > maxRuntime {
+			return fmt.Sprintf("Stopped after running for more than %d minutes", limits.MaxRuntimeMinutes), nil
+		}
+	}
+
+	if limits.MaxEstimatedTimeRemainingMinutes > 0 {
+		maxRemaining := int64(limits.MaxEstimatedTimeRemainingMinutes) * 60
+		for _, job := range jobs {
+			if job.RuntimeData.Status != db.JobStatusStarted || time.Since(job.RuntimeData.StartedTime) < estimateSettleTime {
+				continue
+			}
+
+			if job.RuntimeData.ToSummaryDTO().EstimatedTimeRemaining > maxRemaining {
+				return fmt.Sprintf("Stopped as it was estimated to take more than another %d minutes", limits.MaxEstimatedTimeRemainingMinutes), nil
+			}
+		}
+	}
+
+	if limits.StopAtCrackedPercent > 0 {
+		percent, err := db.GetHashlistCrackedPercent(attack.HashlistID.String())
+		if err != nil {
+			return "", err
+		}
+		if percent >= float64(limits.StopAtCrackedPercent) {
+			return fmt.Sprintf("Stopped as %d%% of the hashlist was cracked", limits.StopAtCrackedPercent), nil
+		}
+	}
+
+	return "", nil
+}
+
+// Stops any attacks with incomplete jobs that have gone over one of their limits
+// Assumes the fleet lock is held
+func enforceAttackLimitsUnsafe(incompleteJobs []db.Job) error {
+	jobsByAttack := make(map[string][]db.Job)
+	for _, job := range incompleteJobs {
+		attackId := job.AttackID.String()
+		jobsByAttack[attackId] = append(jobsByAttack[attackId], job)
+	}
+	if len(jobsByAttack) == 0 {
+		return nil
+	}
+
+	attackIds := make([]string, 0, len(jobsByAttack))
+	for attackId := range jobsByAttack {
+		attackIds = append(attackIds, attackId)
+	}
+
+	attacks, err := db.GetAttacksWithLimits(attackIds)
+	if err != nil {
+		return err
+	}
+
+	for _, attack := range attacks {
+		attackId := attack.ID.String()
+
+		reason, err := attackLimitExceeded(attack, jobsByAttack[attackId])
+		if err != nil {
+			log.WithError(err).WithField("attack_id", attackId).Error("Failed to check attack's limits")
+			continue
+		}
+		if reason == "" {
+			continue
+		}
+
+		log.WithField("attack_id", attackId).WithField("reason", reason).Info("Stopping attack that went over its limits")
+
+		err = db.SetAttackLimitStopMessage(attackId, reason)
+		if err != nil {
+			log.WithError(err).WithField("attack_id", attackId).Error("Failed to record why attack was stopped")
+		}
+
+		err = stopAttackUnsafe(attackId, db.JobStopReasonBudgetExceeded)
+		if err != nil {
+			log.WithError(err).WithField("attack_id", attackId).Error("Failed to stop attack that went over its limits")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,366 @@
+package fleet
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lachlan2k/phatcrack/api/internal/attacksharder"
+	"github.com/lachlan2k/phatcrack/api/internal/config"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+)
+
+// How often we check the queue, even if nothing has poked us
+const dispatchInterval = 10 * time.Second
+
+// devices is which of the agent's devices the job gets, nil for all of them
+func startJobOnAgentUnsafe(job db.Job, agentConnection *AgentConnection, devices []int) error {
+	err := db.SetJobScheduled(job.ID.String(), agentConnection.agentId, devices)
+	if err != nil {
+		return err
+	}
+
+	hashcatParams := job.HashcatParams.Data()
+	hashcatParams.BackendDevices = devices
+
+	err = agentConnection.sendMessage(wstypes.JobStartType, wstypes.JobStartDTO{
+		ID:            job.ID.String(),
+		HashcatParams: hashcatParams,
+		TargetHashes:  job.TargetHashes,
+
+		AssociatedHints: job.AssociatedHints,
+	})
+	if err != nil {
+		// We couldn't reach the agent, so put the job back in the queue for someone else to pick up
+		queueErr := db.SetJobQueued(job.ID.String())
+		if queueErr != nil {
+			return fmt.Errorf("couldn't send job to agent (%v), and couldn't put it back in the queue: %w", err, queueErr)
+		}
+		return fmt.Errorf("couldn't send job to agent: %w", err)
+	}
+
+	return nil
+}
+
+// Something the dispatcher could hand to an agent: either a job sitting in the queue, or the next chunk of a chunked attack
+type dispatchCandidate struct {
+	job    *db.Job
+	attack *db.Attack
+
+	priority      int
+	ownerUsername string
+
+	// Which agents are allowed to take the work
+	constraints db.AgentConstraints
+
+	// How many chunks of the attack we've handed out this pass, so chunked attacks of the same user take turns
+	chunksDispatched int
+}
+
+// Decides whether a should be dispatched before b
+// Higher priority always wins. Within a priority, the user with the fewest running jobs gets the next slot (fair-share)
+// After that, queued jobs go before new chunks, and otherwise whoever has been waiting longest goes first
+func (a dispatchCandidate) isBefore(b dispatchCandidate, runningJobsPerUser map[string]int) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+
+	if runningJobsPerUser[a.ownerUsername] != runningJobsPerUser[b.ownerUsername] {
+		return runningJobsPerUser[a.ownerUsername] < runningJobsPerUser[b.ownerUsername]
+	}
+
+	if (a.job != nil) != (b.job != nil) {
+		return a.job != nil
+	}
+
+	if a.attack != nil && b.attack != nil {
+		return a.chunksDispatched < b.chunksDispatched
+	}
+
+	return false
+}
+
+func getDispatchCandidates() ([]dispatchCandidate, error) {
+	queuedJobs, err := db.GetAllQueuedJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	chunkedAttacks, err := db.GetAllActiveChunkedAttacks()
+	if err != nil {
+		return nil, err
+	}
+
+	attackIds := []string{}
+	for _, job := range queuedJobs {
+		if job.AttackID != nil {
+			attackIds = append(attackIds, job.AttackID.String())
+		}
+	}
+	for _, attack := range chunkedAttacks {
+		attackIds = append(attackIds, attack.ID.String())
+	}
+
+	schedulingInfo := map[string]db.AttackSchedulingInfo{}
+	if len(attackIds) > 0 {
+		schedulingInfo, err = db.GetAttackSchedulingInfo(attackIds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Queued jobs come out oldest first, and we rely on candidates being in that order to break ties
+	candidates := []dispatchCandidate{}
+	for i := range queuedJobs {
+		candidate := dispatchCandidate{job: &queuedJobs[i]}
+		if queuedJobs[i].AttackID != nil {
+			info, ok := schedulingInfo[queuedJobs[i].AttackID.String()]
+			if !ok {
+				// Without its constraints, it could end up somewhere it isn't allowed to run, so it has to wait
+				log.WithField("job_id", queuedJobs[i].ID.String()).Warn("Couldn't find scheduling info for queued job's attack, skipping it")
+				continue
+			}
+			candidate.priority = info.Priority
+			candidate.ownerUsername = info.OwnerUsername
+			candidate.constraints = info.AgentConstraints
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	for i := range chunkedAttacks {
+		info, ok := schedulingInfo[chunkedAttacks[i].ID.String()]
+		if !ok {
+			log.WithField("attack_id", chunkedAttacks[i].ID.String()).Warn("Couldn't find scheduling info for chunked attack, skipping it")
+			continue
+		}
+		candidates = append(candidates, dispatchCandidate{
+			attack:        &chunkedAttacks[i],
+			priority:      info.Priority,
+			ownerUsername: info.OwnerUsername,
+			constraints:   info.AgentConstraints,
+		})
+	}
+
+	return candidates, nil
+}
+
+// Picks the agent the constraints allow with the most free slots, preferring preferredAgentID if they have room
+// Returns "" if every allowed agent is busy
+func pickAgentForJob(agents []db.Agent, freeSlots map[string]int, preferredAgentID *uuid.UUID, constraints db.AgentConstraints) string {
+	agentId := ""
+	for _, agent := range agents {
+		if freeSlots[agent.ID.String()] <= 0 || !constraints.Allows(agent) {
+			continue
+		}
+
+		// If the job was sized for a particular agent and they have room, it should go to them
+		if preferredAgentID != nil && agent.ID == *preferredAgentID {
+			return agent.ID.String()
+		}
+
+		// Otherwise, pick whoever has the most room, so work is spread evenly
+		if agentId == "" || freeSlots[agent.ID.String()] > freeSlots[agentId] {
+			agentId = agent.ID.String()
+		}
+	}
+	return agentId
+}
+
+// Works out which of the agent's devices aren't being used by the jobs it already has
+// Returns false if we don't know what devices the agent has yet, in which case jobs just get all of them
+func getFreeDevices(agent db.Agent, assignedDevices [][]int) ([]int, bool) {
+	deviceIds := agent.DeviceIDs()
+	if len(deviceIds) == 0 {
+		return nil, false
+	}
+
+	for _, jobDevices := range assignedDevices {
+		if len(jobDevices) == 0 {
+			// The job has all of them
+			return []int{}, true
+		}
+		deviceIds = slices.DeleteFunc(deviceIds, func(deviceId int) bool { return slices.Contains(jobDevices, deviceId) })
+	}
+	return deviceIds, true
+}
+
+// Hands out queued jobs, and chunks of chunked attacks, to agents that have free job slots
+// Whenever a slot is free, it goes to the best candidate according to dispatchCandidate.isBefore, out of those whose constraints allow one of the free agents
+// Agents only have as many free slots as they have free devices, and the free devices are shared out between the free slots
+func scheduleQueuedJobsUnsafe() error {
+	if config.Get().General.IsMaintenanceMode {
+		return nil
+	}
+
+	schedulableAgents, err := db.GetAllSchedulableAgents()
+	if err != nil {
+		return err
+	}
+
+	// Only agents that we actually have a connection to are any use to us
+	// Agents that are benchmarking have to wait, a job would fight the benchmark for the devices
+	schedulableAgents = slices.DeleteFunc(schedulableAgents, func(agent db.Agent) bool {
+		agentConnection, ok := fleet[agent.ID.String()]
+		return !ok || agentConnection == nil || agentConnection.pendingBenchmarks > 0
+	})
+
+	if len(schedulableAgents) == 0 {
+		// Nobody to give the jobs to, they can wait in the queue
+		return nil
+	}
+
+	assignedJobCounts, err := db.GetAssignedJobCountPerAgent()
+	if err != nil {
+		return err
+	}
+
+	assignedDevices, err := db.GetAssignedDevicesPerAgent()
+	if err != nil {
+		return err
+	}
+
+	freeSlots := make(map[string]int, len(schedulableAgents))
+	// Only has agents that we know the devices of
+	freeDevices := make(map[string][]int, len(schedulableAgents))
+	for _, agent := range schedulableAgents {
+		agentId := agent.ID.String()
+		freeSlots[agentId] = agent.JobSlots() - assignedJobCounts[agentId]
+
+		devices, ok := getFreeDevices(agent, assignedDevices[agentId])
+		if ok {
+			freeDevices[agentId] = devices
+			freeSlots[agentId] = min(freeSlots[agentId], len(devices))
+		}
+	}
+
+	candidates, err := getDispatchCandidates()
+	if err != nil {
+		return err
+	}
+
+	runningJobCounts, err := db.GetRunningJobCountPerUser()
+	if err != nil {
+		return err
+	}
+
+	runningJobsPerUser := make(map[string]int, len(runningJobCounts))
+	for _, count := range runningJobCounts {
+		runningJobsPerUser[count.Username] = int(count.JobCount)
+	}
+
+	for len(candidates) > 0 {
+		if !slices.ContainsFunc(schedulableAgents, func(agent db.Agent) bool { return freeSlots[agent.ID.String()] > 0 }) {
+			// Everyone is busy, the rest will have to wait
+			break
+		}
+
+		best := 0
+		for i := range candidates {
+			if candidates[i].isBefore(candidates[best], runningJobsPerUser) {
+				best = i
+			}
+		}
+		candidate := &candidates[best]
+		ownerUsername := candidate.ownerUsername
+
+		var job *db.Job
+		var agentId string
+		if candidate.job != nil {
+			job = candidate.job
+			agentId = pickAgentForJob(schedulableAgents, freeSlots, job.PreferredAgentID, candidate.constraints)
+			candidates = slices.Delete(candidates, best, best+1)
+			if agentId == "" {
+				// None of the free agents are allowed to take it, so it waits without holding up anyone else's work
+				continue
+			}
+		} else {
+			// Chunks are cut to order, so they belong to whoever allowed has the most room right now
+			agentId = pickAgentForJob(schedulableAgents, freeSlots, nil, candidate.constraints)
+			if agentId == "" {
+				candidates = slices.Delete(candidates, best, best+1)
+				continue
+			}
+			preferredAgentID := uuid.MustParse(agentId)
+
+			job, _, err = attacksharder.MakeNextChunkJob(candidate.attack, &preferredAgentID)
+			if err != nil {
+				// Stop cutting chunks for it, otherwise it'd fail again every pass, and it mustn't hold up everyone else's work
+				log.WithField("attack_id", candidate.attack.ID.String()).WithError(err).Error("Failed to make next chunk of attack, no more chunks will be handed out")
+				stopErr := db.StopAttackChunking(candidate.attack.ID.String())
+				if stopErr != nil {
+					log.WithField("attack_id", candidate.attack.ID.String()).WithError(stopErr).Error("Failed to stop chunking attack")
+				}
+				candidates = slices.Delete(candidates, best, best+1)
+				continue
+			}
+			if job == nil {
+				// Nothing left to hand out for this attack
+				candidates = slices.Delete(candidates, best, best+1)
+				continue
+			}
+			candidate.chunksDispatched++
+		}
+
+		// e.g. with 4 free devices and 2 free slots, the job gets 2 of them
+		var devices []int
+		if agentDevices, ok := freeDevices[agentId]; ok {
+			devices = agentDevices[:len(agentDevices)/freeSlots[agentId]]
+		}
+
+		err := startJobOnAgentUnsafe(*job, fleet[agentId], devices)
+		if err != nil {
+			log.
+				WithField("job_id", job.ID.String()).
+				WithField("agent_id", agentId).
+				WithError(err).
+				Error("Failed to start job on agent")
+
+			// Don't keep trying the agent this pass
+			freeSlots[agentId] = 0
+			continue
+		}
+
+		freeSlots[agentId]--
+		if devices != nil {
+			freeDevices[agentId] = freeDevices[agentId][len(devices):]
+		}
+		runningJobsPerUser[ownerUsername]++
+	}
+
+	return nil
+}
+
+func scheduleQueuedJobs() error {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	return scheduleQueuedJobsUnsafe()
+}
+
+var dispatchQueue = make(chan interface{}, 1)
+
+func dispatchTask() {
+	for {
+		select {
+		case <-time.After(dispatchInterval):
+		case <-dispatchQueue:
+		}
+
+		err := scheduleQueuedJobs()
+		if err != nil {
+			log.WithError(err).Error("Failed to dispatch queued jobs")
+		}
+	}
+}
+
+// Requests that the dispatcher has a look at the queue, e.g. because an agent has become available
+func QueueDispatch() {
+	select {
+	case dispatchQueue <- nil:
+	default: // Channel already full, already been signalled, no need to block
+	}
+}
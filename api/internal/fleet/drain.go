@@ -0,0 +1,78 @@
+package fleet
+
+import (
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+	log "github.com/sirupsen/logrus"
+)
+
+// Stops the agent being given new work. If migrateRunningJobs is set, its running jobs are paused,
+// and put back in the queue from where they got up to as soon as they've stopped, so another agent can carry on with them
+// Otherwise, they're left to finish. Either way, the agent is drained once it has nothing left running
+func DrainAgent(agentId string, migrateRunningJobs bool) error {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	err := db.UpdateAgentDraining(agentId, true)
+	if err != nil {
+		return err
+	}
+
+	if !migrateRunningJobs {
+		return nil
+	}
+
+	// Jobs that are still waiting to start are left alone, as the agent may not know about them yet to pause them
+	jobs, err := db.GetRunningJobsForAgent(agentId)
+	if err != nil {
+		return err
+	}
+
+	agentConnection, ok := fleet[agentId]
+	if !ok {
+		// If it comes back, it'll report the jobs as gone and they'll be recovered as usual
+		return nil
+	}
+
+	for _, job := range jobs {
+		err := db.SetJobMigrating(job.ID.String())
+		if err != nil {
+			return err
+		}
+
+		err = agentConnection.sendMessage(wstypes.JobPauseType, wstypes.JobPauseDTO{
+			JobID: job.ID.String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		log.WithField("job_id", job.ID.String()).WithField("agent_id", agentId).Info("Migrating job off draining agent")
+	}
+
+	return nil
+}
+
+// Lets the agent be given new work again
+func UndrainAgent(agentId string) error {
+	err := db.UpdateAgentDraining(agentId, false)
+	if err != nil {
+		return err
+	}
+
+	QueueDispatch()
+	return nil
+}
+
+// Once a job being migrated off a draining agent has paused, it goes straight back in the queue
+func resumeIfMigratingUnsafe(jobId string) error {
+	job, err := db.GetJob(jobId, true)
+	if err != nil {
+		return err
+	}
+	if !job.RuntimeData.IsMigrating {
+		return nil
+	}
+
+	return resumeJobUnsafe(*job)
+}
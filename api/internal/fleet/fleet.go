@@ -7,17 +7,17 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/lachlan2k/phatcrack/api/internal/attacksharder"
 	"github.com/lachlan2k/phatcrack/api/internal/config"
 	"github.com/lachlan2k/phatcrack/api/internal/db"
-	"github.com/lachlan2k/phatcrack/common/pkg/apitypes"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
 	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
 	"github.com/sirupsen/logrus"
 )
 
 var ErrJobDoesntExist = errors.New("job doesn't exist")
 var ErrJobAlreadyScheduled = errors.New("job already scheduled to start")
-
-var ErrNoAgentsOnline = errors.New("no agents online")
+var ErrAgentNotConnected = errors.New("agent isn't connected")
 
 var fleetLock sync.Mutex
 var fleet = make(map[string]*AgentConnection)
@@ -64,11 +64,98 @@ func RemoveAgentByID(projectId string) {
 	delete(fleet, projectId)
 }
 
-func ScheduleJobs(jobIds []string) ([]string, error) {
+// Puts the jobs in the queue, they will be handed out to agents by the dispatcher as agents become available
+func QueueJobs(jobIds []string) error {
 	fleetLock.Lock()
 	defer fleetLock.Unlock()
 
-	return scheduleJobUnsafe(jobIds)
+	for _, jobId := range jobIds {
+		job, err := db.GetJob(jobId, true)
+		if err == db.ErrNotFound || job == nil {
+			return ErrJobDoesntExist
+		}
+		if err != nil {
+			return err
+		}
+
+		switch job.RuntimeData.Status {
+		case db.JobStatusQueued, db.JobStatusAwaitingStart, db.JobStatusStarted, db.JobStatusPaused:
+			return ErrJobAlreadyScheduled
+		}
+	}
+
+	for _, jobId := range jobIds {
+		err := db.SetJobQueued(jobId)
+		if err != nil {
+			return err
+		}
+	}
+
+	QueueDispatch()
+	return nil
+}
+
+// Splits the attack up into jobs and puts them in the queue, returning the IDs of the new jobs
+func StartAttack(attack *db.Attack) (jobIDs []string, err error) {
+	jobMultiplier := config.Get().Agent.SplitJobsPerAgent
+	if jobMultiplier <= 0 {
+		jobMultiplier = 1
+	}
+
+	// Start the clock before any jobs are queued, so the limits never see a running attack without a start time
+	err = db.MarkAttackStarted(attack.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		startState := db.AttackStartStateStarted
+		if err != nil {
+			startState = db.AttackStartStateFailed
+		}
+
+		stateErr := db.SetAttackStartState(attack.ID.String(), startState)
+		if stateErr != nil {
+			logrus.WithError(stateErr).WithField("attack_id", attack.ID.String()).Warn("Couldn't record whether attack started")
+		}
+	}()
+
+	constraints, err := db.GetAttackAgentConstraints(attack.ID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get which agents the attack may run on: %w", err)
+	}
+
+	shardTargets, err := attacksharder.PlanShards(attack.HashcatParams.Data().HashType, jobMultiplier, constraints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan how to split up the attack: %w", err)
+	}
+
+	newJobs, _, err := attacksharder.MakeJobs(attack, shardTargets)
+	if err != nil {
+		return nil, err
+	}
+
+	jobIDs = []string{}
+	for _, job := range newJobs {
+		jobIDs = append(jobIDs, job.ID.String())
+	}
+
+	err = QueueJobs(jobIDs)
+	if err != nil {
+		// The dispatcher may have already started cutting chunks, so stop those, and stop it from cutting any more
+		stopErr := StopAttack(attack.ID.String(), db.JobStopReasonFailedToStart)
+		if stopErr != nil {
+			logrus.WithError(stopErr).WithField("attack_id", attack.ID.String()).Error("Failed to stop attack that couldn't be started")
+		}
+
+		for _, newJob := range newJobs {
+			// If the deletion fails, there's not much for us to do really
+			db.HardDelete(newJob)
+		}
+		return nil, err
+	}
+
+	return jobIDs, nil
 }
 
 func NumSchedulableAgents() int {
@@ -79,73 +166,159 @@ func NumSchedulableAgents() int {
 	return len(agents)
 }
 
-// Jobs will be evenly spread across agents
-func scheduleJobUnsafe(jobIds []string) ([]string, error) {
-	if len(fleet) == 0 {
-		return nil, ErrNoAgentsOnline
+func StopJob(job db.Job, reason string) {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	stopJobUnsafe(job, reason)
+}
+
+func stopJobUnsafe(job db.Job, reason string) {
+	// If it's still in the queue, there's no agent to tell, just take it out of the queue
+	wasQueued, err := db.CancelQueuedJob(job.ID.String(), reason)
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID.String()).Error("Failed to remove job from queue")
+	}
+	if wasQueued {
+		return
 	}
 
-	var jobs []apitypes.JobDTO
+	tellAgentToKillJob(job.AssignedAgentID, &job.ID, reason)
+}
 
-	for _, jobId := range jobIds {
-		jobDb, err := db.GetJob(jobId, false)
-		if err == db.ErrNotFound || jobDb == nil {
-			return nil, ErrJobDoesntExist
-		}
-		jobs = append(jobs, jobDb.ToDTO())
+// Stops handing out chunks of the attack, and stops all of its jobs
+func StopAttack(attackId string, reason string) error {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	return stopAttackUnsafe(attackId, reason)
+}
+
+func stopAttackUnsafe(attackId string, reason string) error {
+	// Stop handing out chunks first, otherwise the dispatcher could start a new one as we stop the rest
+	err := db.StopAttackChunking(attackId)
+	if err != nil {
+		return err
 	}
 
-	schedulableAgents, err := db.GetAllSchedulableAgents()
+	jobs, err := db.GetJobsForAttack(attackId, false, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, agent := range schedulableAgents {
-		_, ok := fleet[agent.ID.String()]
-		if !ok {
-			return nil, fmt.Errorf("agent %q was supposed to be healthy, but couldn't be found in the fleet", agent.ID.String())
-		}
+	for _, job := range jobs {
+		stopJobUnsafe(job, reason)
 	}
+	return nil
+}
 
-	if len(schedulableAgents) == 0 {
-		return nil, ErrNoAgentsOnline
+func PauseJob(job db.Job) {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	// If it's still in the queue, it can just be held back
+	wasQueued, err := db.PauseQueuedJob(job.ID.String())
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID.String()).Error("Failed to pause queued job")
+	}
+	if wasQueued || job.AssignedAgentID == nil {
+		return
 	}
 
-	agentsJobsScheduledTo := []string{}
+	// Otherwise, the agent will tell us where it got up to when the job exits
+	// It might not have started the job yet, or might not be connected, so remember to ask again (see resendJobPausesUnsafe)
+	err = db.SetJobPausing(job.ID.String())
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID.String()).Error("Failed to mark job as pausing")
+	}
 
-	for len(jobs) > 0 {
-		for _, agent := range schedulableAgents {
-			if len(jobs) == 0 {
-				break
-			}
-			job := jobs[0]
-			jobs = jobs[1:]
+	agentConnection, ok := fleet[job.AssignedAgentID.String()]
+	if ok {
+		agentConnection.sendMessage(wstypes.JobPauseType, wstypes.JobPauseDTO{
+			JobID: job.ID.String(),
+		})
+	}
+}
 
-			agentConnection, ok := fleet[agent.ID.String()]
-			if !ok || agentConnection == nil {
-				// Shouldn't happen because we've already collected the agents and we have a lock
-				logrus.WithField("agent_id", agent.ID.String()).Warn("Agent was supposed to be online, but couldn't be found in the fleet")
-				continue
-			}
-			agentsJobsScheduledTo = append(agentsJobsScheduledTo, agent.ID.String())
+// Asks the agent again to pause any jobs it hasn't paused yet
+// A pause can arrive at the agent before the job it's for has started, in which case the agent has nothing to pause
+func (a *AgentConnection) resendJobPausesUnsafe() error {
+	jobs, err := db.GetJobsToPauseForAgent(a.agentId)
+	if err != nil {
+		return err
+	}
 
-			db.SetJobScheduled(job.ID, agent.ID.String())
-			agentConnection.sendMessage(wstypes.JobStartType, wstypes.JobStartDTO{
-				ID:            job.ID,
-				HashcatParams: job.HashcatParams,
-				TargetHashes:  job.TargetHashes,
-			})
+	for _, job := range jobs {
+		err := a.sendMessage(wstypes.JobPauseType, wstypes.JobPauseDTO{
+			JobID: job.ID.String(),
+		})
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// Works out the params for the rest of a job, given how far hashcat got through it
+func remainingJobParams(params hashcattypes.HashcatParams, restorePoint int64) hashcattypes.HashcatParams {
+	// Hashcat doesn't support --skip with --increment, so those have to start again from scratch
+	// Association jobs are sized by the hash/hint pairs they're given rather than a keyspace, so they start again too
+	if params.MaskIncrement || params.AttackMode == hashcattypes.AttackModeAssociation || restorePoint <= params.Skip {
+		return params
+	}
 
-	return agentsJobsScheduledTo, nil
+	// --limit is relative to --skip, so it has to shrink by however much we're skipping over
+	if params.Limit > 0 {
+		params.Limit = max(1, params.Skip+params.Limit-restorePoint)
+	}
+	params.Skip = restorePoint
+
+	return params
 }
 
-func StopJob(job db.Job, reason string) {
+func ResumeJob(job db.Job) error {
 	fleetLock.Lock()
 	defer fleetLock.Unlock()
 
-	tellAgentToKillJob(job.AssignedAgentID, &job.ID, reason)
+	return resumeJobUnsafe(job)
+}
+
+func resumeJobUnsafe(job db.Job) error {
+	params := remainingJobParams(job.HashcatParams.Data(), job.RuntimeData.RestorePoint)
+
+	resumed, err := db.ResumePausedJob(job.ID.String(), params)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		QueueDispatch()
+	}
+
+	return nil
+}
+
+// Asks the agent to benchmark each of the hash types, which it works through one at a time
+func RequestBenchmark(agentId string, hashTypes ...uint) error {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	agentConnection, ok := fleet[agentId]
+	if !ok {
+		return ErrAgentNotConnected
+	}
+
+	for _, hashType := range hashTypes {
+		err := agentConnection.sendMessage(wstypes.BenchmarkRequestType, wstypes.BenchmarkRequestDTO{
+			HashType: hashType,
+		})
+		if err != nil {
+			return err
+		}
+
+		agentConnection.pendingBenchmarks++
+	}
+
+	return nil
 }
 
 func RequestFileDownload(fileIDs ...uuid.UUID) {
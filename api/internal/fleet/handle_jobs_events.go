@@ -1,6 +1,7 @@
 package fleet
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/lachlan2k/phatcrack/api/internal/db"
@@ -22,7 +23,13 @@ func (a *AgentConnection) handleJobStarted(msg *wstypes.Message) error {
 		"hashcat_command": payload.HashcatCommand,
 	}).Warn("Job started")
 
-	return db.SetJobStarted(payload.JobID, payload.HashcatCommand, payload.Time)
+	err = db.SetJobStarted(payload.JobID, payload.HashcatCommand, payload.Time)
+	if err != nil {
+		return err
+	}
+
+	// If we asked for it to be paused before it started, the agent won't have been able to
+	return a.resendJobPausesUnsafe()
 }
 
 func (a *AgentConnection) handleJobCrackedHash(msg *wstypes.Message) error {
@@ -31,7 +38,14 @@ func (a *AgentConnection) handleJobCrackedHash(msg *wstypes.Message) error {
 		return fmt.Errorf("couldn't unmarshal %v to cracked hash dto: %w", msg.Payload, err)
 	}
 
+	// The agent sends it again after reconnecting if it doesn't hear back from us, so we might have already stored it
+	// Everything here is safe to repeat, and we only acknowledge once it's all done
 	err = db.AddJobCrackedHash(payload.JobID, payload.Result.Hash, payload.Result.PlaintextHex)
+	if errors.Is(err, db.ErrNotFound) {
+		// Otherwise the agent would keep sending it forever
+		log.WithField("agent_id", a.agentId).WithField("job_id", payload.JobID).Warn("Agent sent a cracked hash for a job that doesn't exist, discarding it")
+		return a.sendJobCrackedHashAck(payload.Seq)
+	}
 	if err != nil {
 		return err
 	}
@@ -46,7 +60,60 @@ func (a *AgentConnection) handleJobCrackedHash(msg *wstypes.Message) error {
 		PlaintextHex: payload.Result.PlaintextHex,
 		HashType:     uint(hashType),
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	return a.sendJobCrackedHashAck(payload.Seq)
+}
+
+func (a *AgentConnection) handleJobCrackedHashBatch(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.JobCrackedHashBatchDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to cracked hash batch dto: %w", msg.Payload, err)
+	}
+
+	// Same as a single cracked hash, all of this is safe to repeat if the agent sends the batch again
+	err = db.AddJobCrackedHashes(payload.JobID, payload.Results)
+	if errors.Is(err, db.ErrNotFound) {
+		log.WithField("agent_id", a.agentId).WithField("job_id", payload.JobID).Warn("Agent sent cracked hashes for a job that doesn't exist, discarding them")
+		return a.sendJobCrackedHashAck(payload.Seq)
+	}
+	if err != nil {
+		return err
+	}
+
+	hashType, err := db.GetJobHashtype(payload.JobID)
+	if err != nil {
+		return err
+	}
+
+	potfileEntries := make([]db.PotfileEntry, len(payload.Results))
+	for i, result := range payload.Results {
+		potfileEntries[i] = db.PotfileEntry{
+			Hash:         result.Hash,
+			PlaintextHex: result.PlaintextHex,
+			HashType:     uint(hashType),
+		}
+	}
+
+	err = db.AddPotfileEntries(potfileEntries)
+	if err != nil {
+		return err
+	}
+
+	return a.sendJobCrackedHashAck(payload.Seq)
+}
+
+func (a *AgentConnection) sendJobCrackedHashAck(seq uint64) error {
+	// Older agents don't number their cracked hashes, and don't expect to hear back
+	if seq == 0 {
+		return nil
+	}
+
+	return a.sendMessage(wstypes.JobCrackedHashAckType, wstypes.JobCrackedHashAckDTO{
+		Seq: seq,
+	})
 }
 
 func (a *AgentConnection) handleJobStdLine(msg *wstypes.Message) error {
@@ -77,6 +144,17 @@ func (a *AgentConnection) handleJobExited(msg *wstypes.Message) error {
 		return fmt.Errorf("couldn't unmarshal %v to job exited dto: %w", msg.Payload, err)
 	}
 
+	defer QueueDispatch()
+	defer QueuePipelineAdvance()
+
+	if payload.Paused {
+		err := db.SetJobPaused(payload.JobID, payload.StopReason, payload.RestorePoint, payload.Time)
+		if err != nil {
+			return err
+		}
+		return resumeIfMigratingUnsafe(payload.JobID)
+	}
+
 	reason := payload.StopReason
 
 	if reason == "" {
@@ -95,5 +173,8 @@ func (a *AgentConnection) handleJobFailedToStart(msg *wstypes.Message) error {
 		return fmt.Errorf("couldn't unmarshal %v to job failed to start dto: %w", msg.Payload, err)
 	}
 
+	defer QueueDispatch()
+	defer QueuePipelineAdvance()
+
 	return db.SetJobExited(payload.JobID, db.JobStopReasonFailedToStart, payload.Error, payload.Time)
 }
@@ -0,0 +1,66 @@
+package fleet
+
+import (
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+	log "github.com/sirupsen/logrus"
+)
+
+// The agent was restarted part way through these jobs, and has checkpoints it can resume them from
+// It picks back up the ones that are still meant to be running on it, and throws away the rest,
+// e.g. because we gave up on the agent and handed the job to someone else in the meantime
+func (a *AgentConnection) handleRecoverableJobsUnsafe(recoverableJobs []wstypes.RecoverableJobDTO) error {
+	for _, recoverable := range recoverableJobs {
+		logger := log.
+			WithField("agent_id", a.agentId).
+			WithField("job_id", recoverable.JobID).
+			WithField("restore_point", recoverable.RestorePoint)
+
+		if !a.canResumeJob(recoverable.JobID) {
+			logger.Info("Telling agent to discard checkpoint of job that is no longer meant to be running on it")
+
+			err := a.sendMessage(wstypes.JobKillType, wstypes.JobKillDTO{
+				JobID:      recoverable.JobID,
+				StopReason: db.JobStopReasonFailed,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		logger.Warn("Agent was restarted part way through job, resuming it from its checkpoint")
+
+		err := a.sendMessage(wstypes.JobResumeType, wstypes.JobResumeDTO{
+			JobID: recoverable.JobID,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = db.AddJobStdline(recoverable.JobID, db.JobStdLineStreamStderr, "The agent was restarted, resuming the job from its last checkpoint")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *AgentConnection) canResumeJob(jobId string) bool {
+	job, err := db.GetJob(jobId, true)
+	if err != nil {
+		return false
+	}
+
+	if job.AssignedAgentID == nil || job.AssignedAgentID.String() != a.agentId {
+		return false
+	}
+
+	switch job.RuntimeData.Status {
+	case db.JobStatusAwaitingStart, db.JobStatusStarted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,345 @@
+package fleet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lachlan2k/phatcrack/api/internal/config"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/filerepo"
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+)
+
+// How often we check whether a pipeline's current stage has finished, even if nothing has poked us
+const pipelineInterval = 15 * time.Second
+
+// How long we'll hold a stage back waiting for agents to download its generated wordlist, before starting it regardless
+const generatedWordlistSyncTimeout = 5 * time.Minute
+
+// Plaintexts that can't be written as a plain line are written in hashcat's $HEX[] notation, which it decodes when reading wordlists
+func wordlistLine(plaintext []byte) string {
+	needsHex := bytes.HasPrefix(plaintext, []byte("$HEX["))
+	if bytes.ContainsAny(plaintext, "\r\n") {
+		needsHex = true
+	}
+
+	if needsHex {
+		return "$HEX[" + hex.EncodeToString(plaintext) + "]"
+	}
+	return string(plaintext)
+}
+
+// Writes everything cracked in the pipeline's hashlist so far out to a new wordlist, attached to the hashlist's project
+// Returns nil if nothing has been cracked yet
+func generateCrackedPlaintextsWordlist(pipeline *db.AttackPipeline) (*db.Listfile, error) {
+	plaintextsHex, err := db.GetCrackedPlaintextsForHashlist(pipeline.HashlistID.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintextsHex) == 0 {
+		return nil, nil
+	}
+
+	projId, err := db.GetHashlistProjID(pipeline.HashlistID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	tmpFile, tmpFilePath, err := filerepo.MakeTmp()
+	if err != nil {
+		return nil, err
+	}
+	defer tmpFile.Close()
+
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpFilePath)
+		}
+	}()
+
+	writer := bufio.NewWriter(tmpFile)
+	size, lines := 0, 0
+	for _, plaintextHex := range plaintextsHex {
+		plaintext, err := hex.DecodeString(plaintextHex)
+		if err != nil {
+			continue
+		}
+
+		n, err := writer.WriteString(wordlistLine(plaintext) + "\n")
+		if err != nil {
+			return nil, err
+		}
+		size += n
+		lines++
+	}
+	err = writer.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	projUUID := uuid.MustParse(projId)
+	listfile, err := db.CreateListfile(&db.Listfile{
+		Name:              fmt.Sprintf("%s - stage %d cracked plaintexts", pipeline.Name, pipeline.CurrentStage+1),
+		FileType:          db.ListfileTypeWordlist,
+		SizeInBytes:       uint64(size),
+		Lines:             uint64(lines),
+		CreatedByUserID:   pipeline.CreatedByUserID,
+		AttachedProjectID: &projUUID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filerepo.CreateFromTmp(listfile.ID, tmpFilePath)
+	if err != nil {
+		// It'd never become available, so don't leave it lying around
+		db.HardDelete(listfile)
+		return nil, err
+	}
+	success = true
+
+	err = db.MarkListfileAsAvailable(listfile.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	RequestFileDownload(listfile.ID)
+	return listfile, nil
+}
+
+// Whether every agent we could hand the stage to has finished downloading the listfile
+func isListfileOnAllAgents(listfile *db.Listfile) (bool, error) {
+	agents, err := db.GetAllSchedulableAgents()
+	if err != nil {
+		return false, err
+	}
+
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	for _, agent := range agents {
+		if _, connected := fleet[agent.ID.String()]; !connected {
+			continue
+		}
+
+		hasFile := slices.ContainsFunc(agent.AgentInfo.Data().AvailableListfiles, func(file db.AgentFile) bool {
+			return file.Name == listfile.ID.String() && file.Size == int64(listfile.SizeInBytes)
+		})
+		if !hasFile {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Creates the attack for a pipeline stage, splits it up, and puts its jobs in the queue
+func startPipelineStage(pipeline *db.AttackPipeline, params hashcattypes.HashcatParams) (*db.Attack, error) {
+	attack, err := db.CreateAttack(&db.Attack{
+		HashcatParams:  datatypes.NewJSONType(params),
+		IsDistributed:  pipeline.IsDistributed,
+		HashlistID:     pipeline.HashlistID,
+		ProgressString: "Processing (this can take a while)..",
+		PipelineID:     &pipeline.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = StartAttack(attack)
+	if err != nil {
+		// The error gets logged when we give up on the pipeline, the ID lets it be matched up
+		errId := uuid.NewString()
+		db.SetAttackProgressString(attack.ID.String(), "Error #"+errId)
+		return attack, fmt.Errorf("error #%s: %w", errId, err)
+	}
+
+	db.SetAttackProgressString(attack.ID.String(), "")
+	return attack, nil
+}
+
+// Deletes the wordlist generated for the pipeline's current stage, once nothing is using it any more
+func DiscardGeneratedWordlist(pipeline *db.AttackPipeline) {
+	if pipeline.GeneratedWordlistID == nil {
+		return
+	}
+
+	err := db.MarkListfileForDeletion(pipeline.GeneratedWordlistID.String())
+	if err != nil {
+		log.WithError(err).
+			WithField("pipeline_id", pipeline.ID.String()).
+			WithField("listfile_id", pipeline.GeneratedWordlistID.String()).
+			Warn("Failed to mark pipeline's generated wordlist for deletion")
+	}
+}
+
+func finishPipeline(pipeline *db.AttackPipeline, status string, message string) error {
+	_, err := db.UpdateRunningAttackPipeline(pipeline.ID.String(), map[string]interface{}{
+		"status":         status,
+		"status_message": message,
+	})
+	if err != nil {
+		return err
+	}
+
+	DiscardGeneratedWordlist(pipeline)
+	return nil
+}
+
+// Moves a pipeline along: once its current stage's attack is done, the next stage is started
+func advancePipeline(pipeline db.AttackPipeline) error {
+	if pipeline.CurrentAttackID != nil {
+		done, err := db.IsAttackDone(pipeline.CurrentAttackID.String())
+		if err != nil || !done {
+			return err
+		}
+
+		finishedStage := pipeline
+
+		pipeline.CurrentStage++
+		pipeline.CurrentAttackID = nil
+		pipeline.GeneratedWordlistID = nil
+
+		updated, err := db.UpdateRunningAttackPipeline(pipeline.ID.String(), map[string]interface{}{
+			"current_stage":         pipeline.CurrentStage,
+			"current_attack_id":     nil,
+			"generated_wordlist_id": nil,
+		})
+		if err != nil || !updated {
+			return err
+		}
+
+		// The stage's attack was the only thing using it
+		DiscardGeneratedWordlist(&finishedStage)
+	}
+
+	for {
+		uncracked, err := db.GetUncrackedHashCount(pipeline.HashlistID.String())
+		if err != nil {
+			return err
+		}
+		if uncracked == 0 {
+			return finishPipeline(&pipeline, db.AttackPipelineStatusFinished, "All hashes cracked")
+		}
+
+		if pipeline.CurrentStage >= len(pipeline.Stages) {
+			return finishPipeline(&pipeline, db.AttackPipelineStatusFinished, "All stages complete")
+		}
+
+		if config.Get().General.IsMaintenanceMode {
+			return nil
+		}
+
+		stage := pipeline.Stages[pipeline.CurrentStage]
+		params := stage.HashcatParams
+
+		if stage.UseCrackedPlaintexts {
+			if pipeline.GeneratedWordlistID == nil {
+				listfile, err := generateCrackedPlaintextsWordlist(&pipeline)
+				if err != nil {
+					finishPipeline(&pipeline, db.AttackPipelineStatusFailed, fmt.Sprintf("Failed to generate wordlist for stage %d", pipeline.CurrentStage+1))
+					return err
+				}
+
+				if listfile == nil {
+					// Nothing has been cracked, so there's nothing to feed forward
+					pipeline.CurrentStage++
+					_, err := db.UpdateRunningAttackPipeline(pipeline.ID.String(), map[string]interface{}{
+						"current_stage":  pipeline.CurrentStage,
+						"status_message": fmt.Sprintf("Skipped stage %d, nothing has been cracked yet", pipeline.CurrentStage),
+					})
+					if err != nil {
+						return err
+					}
+					continue
+				}
+
+				// Give the agents a chance to download it before we start the stage
+				_, err = db.UpdateRunningAttackPipeline(pipeline.ID.String(), map[string]interface{}{
+					"generated_wordlist_id": listfile.ID,
+					"status_message":        fmt.Sprintf("Waiting for agents to download the wordlist for stage %d", pipeline.CurrentStage+1),
+				})
+				return err
+			}
+
+			listfile, err := db.GetListfile(pipeline.GeneratedWordlistID.String())
+			if err != nil {
+				return err
+			}
+
+			if config.Get().Agent.AutomaticallySyncListfiles && time.Since(listfile.CreatedAt) < generatedWordlistSyncTimeout {
+				ready, err := isListfileOnAllAgents(listfile)
+				if err != nil || !ready {
+					return err
+				}
+			}
+
+			params.WordlistFilenames = append([]string{listfile.ID.String()}, params.WordlistFilenames...)
+		}
+
+		attack, err := startPipelineStage(&pipeline, params)
+		if err != nil {
+			finishPipeline(&pipeline, db.AttackPipelineStatusFailed, fmt.Sprintf("Failed to start stage %d", pipeline.CurrentStage+1))
+			return err
+		}
+
+		updated, err := db.UpdateRunningAttackPipeline(pipeline.ID.String(), map[string]interface{}{
+			"current_attack_id": attack.ID,
+			"status_message":    fmt.Sprintf("Running stage %d of %d", pipeline.CurrentStage+1, len(pipeline.Stages)),
+		})
+		if err != nil {
+			return err
+		}
+		if !updated {
+			// The pipeline was stopped while we were starting the stage
+			return StopAttack(attack.ID.String(), db.JobStopReasonUserStopped)
+		}
+
+		return nil
+	}
+}
+
+func advancePipelines() {
+	pipelines, err := db.GetAllRunningAttackPipelines()
+	if err != nil {
+		log.WithError(err).Error("Failed to get running pipelines")
+		return
+	}
+
+	for _, pipeline := range pipelines {
+		err := advancePipeline(pipeline)
+		if err != nil {
+			log.WithError(err).WithField("pipeline_id", pipeline.ID.String()).Error("Failed to advance pipeline")
+		}
+	}
+}
+
+var pipelineQueue = make(chan interface{}, 1)
+
+func pipelineTask() {
+	for {
+		select {
+		case <-time.After(pipelineInterval):
+		case <-pipelineQueue:
+		}
+
+		advancePipelines()
+	}
+}
+
+// Requests that pipelines are checked to see if they're ready for their next stage, e.g. because a job has finished
+func QueuePipelineAdvance() {
+	select {
+	case pipelineQueue <- nil:
+	default: // Channel already full, already been signalled, no need to block
+	}
+}
@@ -23,6 +23,45 @@ const disconnectTimeToDead = 60 * time.Second
 // We expect jobs will start within 5 seconds, else we'll consider them to be failed
 const acceptableJobStartTime = 30 * time.Second
 
+// How many times a job will be rescheduled after its agent dies, before we assume the job itself is the problem
+const maxJobRecoveries = 3
+
+// Puts a job that was lost along with its agent back in the queue, to carry on from where it got up to
+// Gives up and fails the job if it has already been recovered too many times
+func recoverJobUnsafe(jobId string, reason string) error {
+	job, err := db.GetJob(jobId, true)
+	if err != nil {
+		return err
+	}
+
+	switch job.RuntimeData.Status {
+	case db.JobStatusAwaitingStart, db.JobStatusStarted:
+	default:
+		// Not running, so there's nothing to recover
+		return nil
+	}
+
+	if job.RuntimeData.RecoveryCount >= maxJobRecoveries {
+		return db.SetJobExited(jobId, db.JobStopReasonFailed, fmt.Sprintf("%s. Giving up after rescheduling it %d times.", reason, job.RuntimeData.RecoveryCount), time.Now())
+	}
+
+	params := remainingJobParams(job.HashcatParams.Data(), job.RuntimeData.RestorePoint)
+
+	err = db.RequeueRecoveredJob(jobId, params, reason+". Rescheduling from where it got up to.")
+	if err != nil {
+		return err
+	}
+
+	log.
+		WithField("job_id", jobId).
+		WithField("restore_point", job.RuntimeData.RestorePoint).
+		WithField("recovery_count", job.RuntimeData.RecoveryCount+1).
+		Warn("Rescheduling job that was lost")
+
+	QueueDispatch()
+	return nil
+}
+
 // This will soft fail if the agent isn't connected. In which case, we're probably fine
 func tellAgentToKillJob(agentId *uuid.UUID, jobId *uuid.UUID, reason string) {
 	if agentId == nil || jobId == nil {
@@ -127,13 +166,13 @@ func stateReconciliation() error {
 
 		if newInfo.Status == db.AgentStatusDead && len(activeJobs) > 0 {
 			for _, jobId := range activeJobs {
-				err = db.SetJobExited(jobId, db.JobStopReasonFailed, "The agent running this job died", time.Now())
+				err = recoverJobUnsafe(jobId, "The agent running this job died")
 				if err != nil {
 					log.
 						WithField("agent_id", agent.ID.String()).
 						WithField("job_id", jobId).
 						WithError(err).
-						Error("Failed to update job status in database")
+						Error("Failed to recover job from dead agent")
 				}
 			}
 
@@ -331,12 +370,12 @@ func stateReconciliation() error {
 
 			agentRunningJob, jobOk := jobsOk[jobId]
 			if !jobOk {
-				err = db.SetJobExited(jobId, db.JobStopReasonFailed, "The job disappeared from the agent's list of running jobs. The agent probably died or was restarted.", time.Now())
+				err = recoverJobUnsafe(jobId, "The job disappeared from the agent's list of running jobs. The agent probably died or was restarted")
 				if err != nil {
 					log.
 						WithField("job_id", jobId).
 						WithError(err).
-						Error("Failed to update job status in database")
+						Error("Failed to recover job that disappeared from agent")
 				}
 
 				log.
@@ -376,6 +415,11 @@ func stateReconciliation() error {
 		}
 	}
 
+	err = enforceAttackLimitsUnsafe(incompleteJobs)
+	if err != nil {
+		log.WithError(err).Error("Failed to enforce attack limits")
+	}
+
 	return nil
 }
 
@@ -439,6 +483,14 @@ func Setup() error {
 		}
 	}
 
+	interruptedAttacks, err := db.FailInterruptedAttackStarts()
+	if err != nil {
+		return err
+	}
+	if interruptedAttacks > 0 {
+		log.WithField("count", interruptedAttacks).Warn("Marked attacks that were interrupted while starting as failed")
+	}
+
 	// This state re-conciliation we manually invoke will go out and mark any agents as dead and jobs as failed, as necessar1y
 	err = stateReconciliation()
 	if err != nil {
@@ -446,5 +498,7 @@ func Setup() error {
 	}
 
 	go stateReconciliationTask()
+	go dispatchTask()
+	go pipelineTask()
 	return nil
 }
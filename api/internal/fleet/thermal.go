@@ -0,0 +1,60 @@
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	"github.com/lachlan2k/phatcrack/api/internal/util"
+	"github.com/lachlan2k/phatcrack/common/pkg/wstypes"
+	log "github.com/sirupsen/logrus"
+)
+
+// Saves the admin's override of the agent's thermal policy, and passes it straight on if the agent is connected
+// Otherwise, the agent picks it up when it next connects
+func SetAgentThermalPolicy(agentId string, policy db.AgentThermalPolicy) error {
+	fleetLock.Lock()
+	defer fleetLock.Unlock()
+
+	err := db.UpdateAgentThermalPolicy(agentId, policy)
+	if err != nil {
+		return err
+	}
+
+	agentConnection, ok := fleet[agentId]
+	if !ok || agentConnection == nil {
+		return nil
+	}
+
+	return agentConnection.sendThermalPolicy(policy)
+}
+
+func (a *AgentConnection) sendThermalPolicy(policy db.AgentThermalPolicy) error {
+	return a.sendMessage(wstypes.ThermalPolicyType, wstypes.ThermalPolicyDTO{
+		TempAbort: policy.TempAbort,
+		MaxTemp:   policy.MaxTemp,
+		Action:    policy.Action,
+	})
+}
+
+func (a *AgentConnection) handleThermalEvent(msg *wstypes.Message) error {
+	payload, err := util.UnmarshalJSON[wstypes.ThermalEventDTO](msg.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal %v to thermal event dto: %w", msg.Payload, err)
+	}
+
+	log.
+		WithField("agent_id", a.agentId).
+		WithField("job_id", payload.JobID).
+		WithField("device_id", payload.DeviceID).
+		WithField("temp", payload.Temp).
+		WithField("max_temp", payload.MaxTemp).
+		WithField("action", payload.Action).
+		Warn("Agent stopped a job for going over its thermal limit")
+
+	// So whoever looks at the job can see why it stopped
+	line := fmt.Sprintf(
+		"Device #%d (%s) reached %d°C, over the agent's limit of %d°C, so the job was stopped (%s)",
+		payload.DeviceID, payload.DeviceName, payload.Temp, payload.MaxTemp, payload.Action,
+	)
+	return db.AddJobStdline(payload.JobID, db.JobStdLineStreamStderr, line)
+}
@@ -86,16 +86,40 @@ func CalculateKeyspace(params hashcattypes.HashcatParams) (int64, error) {
 		rulefilePaths = append(rulefilePaths, filePath)
 	}
 
+	// Hashcat only gives the base keyspace, which is what --skip and --limit work on
+	// So for dictionary attacks, any number of (stacked) rule files doesn't change the answer, but we pass them anyway so hashcat validates them
+	positionalArgs := []string{}
+
 	switch params.AttackMode {
 	case hashcattypes.AttackModeDictionary:
-		if len(rulefilePaths) > 1 || len(wordlistPaths) != 1 {
-			return 0, fmt.Errorf("keyspace calculation for dicitonary attack requires exactly 0 or 1 rulefiles and 1 wordlist. found %d and %d", len(rulefilePaths), len(wordlistPaths))
+		if len(wordlistPaths) != 1 {
+			return 0, fmt.Errorf("keyspace calculation for dictionary attack requires exactly 1 wordlist. found %d", len(wordlistPaths))
 		}
+		positionalArgs = append(positionalArgs, wordlistPaths[0])
 
 	case hashcattypes.AttackModeCombinator:
 		if len(rulefilePaths) != 0 || len(wordlistPaths) != 2 {
 			return 0, fmt.Errorf("keyspace calculation for combinator requires exactly 0 rulefiles and 2 wordlists. found %d and %d", len(rulefilePaths), len(wordlistPaths))
 		}
+		positionalArgs = append(positionalArgs, wordlistPaths[0], wordlistPaths[1])
+
+	case hashcattypes.AttackModeMask:
+		if params.Mask == "" {
+			return 0, errors.New("keyspace calculation for mask attack requires a mask")
+		}
+		positionalArgs = append(positionalArgs, params.Mask)
+
+	case hashcattypes.AttackModeHybridDM:
+		if params.Mask == "" || len(wordlistPaths) != 1 {
+			return 0, fmt.Errorf("keyspace calculation for hybrid attack requires a mask and exactly 1 wordlist. found %d", len(wordlistPaths))
+		}
+		positionalArgs = append(positionalArgs, wordlistPaths[0], params.Mask)
+
+	case hashcattypes.AttackModeHybridMD:
+		if params.Mask == "" || len(wordlistPaths) != 1 {
+			return 0, fmt.Errorf("keyspace calculation for hybrid attack requires a mask and exactly 1 wordlist. found %d", len(wordlistPaths))
+		}
+		positionalArgs = append(positionalArgs, params.Mask, wordlistPaths[0])
 
 	default:
 		return 0, fmt.Errorf("keyspace calculation not implemented for attack mode %d", params.AttackMode)
@@ -110,7 +134,26 @@ func CalculateKeyspace(params hashcattypes.HashcatParams) (int64, error) {
 		args = append(args, "-r", rule)
 	}
 
-	args = append(args, wordlistPaths...)
+	switch params.AttackMode {
+	case hashcattypes.AttackModeMask, hashcattypes.AttackModeHybridDM, hashcattypes.AttackModeHybridMD:
+		if params.MaskIncrement {
+			// There's no single keyspace to speak of, and --skip/--limit can't be used with --increment anyway
+			return 0, errors.New("keyspace can't be calculated for masks using --increment")
+		}
+
+		// Custom charsets are stored hex-encoded
+		if len(params.MaskCustomCharsets) > 0 || params.MaskShardedCharset != "" {
+			args = append(args, "--hex-charset")
+		}
+		for i, charset := range params.MaskCustomCharsets {
+			args = append(args, fmt.Sprintf("--custom-charset%d", i+1), charset)
+		}
+		if params.MaskShardedCharset != "" {
+			args = append(args, "--custom-charset4", params.MaskShardedCharset)
+		}
+	}
+
+	args = append(args, positionalArgs...)
 
 	if params.OptimizedKernels {
 		args = append(args, "-O")
@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lachlan2k/phatcrack/api/internal/accesscontrol"
+	"github.com/lachlan2k/phatcrack/api/internal/attackhelpers"
+	"github.com/lachlan2k/phatcrack/api/internal/config"
+	"github.com/lachlan2k/phatcrack/api/internal/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// How often we check for schedules that are due, even if nothing has poked us
+const scheduleInterval = 30 * time.Second
+
+// The outcome of running a schedule, before it's been recorded
+type runResult struct {
+	attackIds []string
+	skipped   []string
+	failed    []string
+}
+
+func (r *runResult) toRun(schedule *db.AttackSchedule) *db.AttackScheduleRun {
+	run := &db.AttackScheduleRun{
+		AttackScheduleID: schedule.ID,
+		AttackIDs:        r.attackIds,
+	}
+
+	messages := append(append([]string{}, r.failed...), r.skipped...)
+
+	switch {
+	case len(r.failed) > 0:
+		run.Outcome = db.AttackScheduleOutcomeFailed
+	case len(r.attackIds) > 0:
+		run.Outcome = db.AttackScheduleOutcomeStarted
+		messages = append([]string{fmt.Sprintf("Started %d attack(s)", len(r.attackIds))}, messages...)
+	default:
+		run.Outcome = db.AttackScheduleOutcomeSkipped
+	}
+
+	run.Message = strings.Join(messages, "\n")
+	return run
+}
+
+// Starts an existing attack, as long as it isn't already running
+func runAttackSchedule(schedule *db.AttackSchedule, creator *db.User, res *runResult) {
+	attackId := schedule.AttackID.String()
+
+	projId, err := db.GetAttackProjID(attackId)
+	if err != nil {
+		res.failed = append(res.failed, "Failed to find the attack's project")
+		return
+	}
+
+	allowed, err := accesscontrol.HasRightsToProjectID(creator, projId)
+	if err != nil || !allowed {
+		res.failed = append(res.failed, "The schedule's creator no longer has access to the attack")
+		return
+	}
+
+	attack, err := db.GetAttack(attackId)
+	if err == db.ErrNotFound {
+		res.failed = append(res.failed, "The attack no longer exists")
+		return
+	}
+	if err != nil {
+		res.failed = append(res.failed, "Failed to fetch the attack")
+		return
+	}
+
+	done, err := db.IsAttackDone(attackId)
+	if err != nil {
+		res.failed = append(res.failed, "Failed to check whether the attack is already running")
+		return
+	}
+	if !done {
+		res.skipped = append(res.skipped, "The attack is still running from before")
+		return
+	}
+
+	uncracked, err := db.GetUncrackedHashCount(attack.HashlistID.String())
+	if err == nil && uncracked == 0 {
+		res.skipped = append(res.skipped, "Every hash in the hashlist is already cracked")
+		return
+	}
+
+	_, err = attackhelpers.StartWithProgress(attack, log.Fields{
+		"attack_id":   attackId,
+		"project_id":  projId,
+		"hashlist_id": attack.HashlistID,
+		"schedule_id": schedule.ID.String(),
+	})
+	if err != nil {
+		res.failed = append(res.failed, "Failed to start the attack (check its progress for the error ID)")
+		return
+	}
+
+	res.attackIds = append(res.attackIds, attackId)
+}
+
+// Creates and starts attacks from the template on every hashlist with the schedule's tag, that the creator has access to
+func runTemplateSchedule(schedule *db.AttackSchedule, creator *db.User, res *runResult) {
+	hashlists, err := db.GetAllHashlistsWithTag(schedule.HashlistTag)
+	if err != nil {
+		res.failed = append(res.failed, "Failed to find hashlists with the tag")
+		return
+	}
+	if len(hashlists) == 0 {
+		res.skipped = append(res.skipped, fmt.Sprintf("No hashlists are tagged %q", schedule.HashlistTag))
+		return
+	}
+
+	for i := range hashlists {
+		hashlist := &hashlists[i]
+		projId := hashlist.ProjectID.String()
+
+		allowed, err := accesscontrol.HasRightsToProjectID(creator, projId)
+		if err != nil || !allowed {
+			// Someone else's hashlist that happens to share a tag, not something to report
+			continue
+		}
+
+		uncracked, err := db.GetUncrackedHashCount(hashlist.ID.String())
+		if err == nil && uncracked == 0 {
+			res.skipped = append(res.skipped, fmt.Sprintf("%s: every hash is already cracked", hashlist.Name))
+			continue
+		}
+
+		attacks, err := attackhelpers.CreateFromTemplate(hashlist, schedule.AttackTemplateID.String(), schedule.IsDistributed, "Processing (waiting to start)..")
+		var validationErr *attackhelpers.ValidationError
+		if errors.As(err, &validationErr) {
+			res.failed = append(res.failed, fmt.Sprintf("%s: %s", hashlist.Name, validationErr.Message))
+			continue
+		}
+		if err == db.ErrNotFound {
+			res.failed = append(res.failed, "The attack template no longer exists")
+			return
+		}
+		if err != nil {
+			res.failed = append(res.failed, fmt.Sprintf("%s: failed to create attacks", hashlist.Name))
+			log.WithError(err).WithField("schedule_id", schedule.ID.String()).WithField("hashlist_id", hashlist.ID.String()).Warn("Failed to create scheduled attacks")
+			continue
+		}
+
+		for _, attack := range attacks {
+			_, err := attackhelpers.StartWithProgress(attack, log.Fields{
+				"attack_id":   attack.ID.String(),
+				"project_id":  projId,
+				"hashlist_id": hashlist.ID.String(),
+				"schedule_id": schedule.ID.String(),
+			})
+			if err != nil {
+				res.failed = append(res.failed, fmt.Sprintf("%s: failed to start attack (check its progress for the error ID)", hashlist.Name))
+				continue
+			}
+			res.attackIds = append(res.attackIds, attack.ID.String())
+		}
+	}
+
+	if len(res.attackIds) == 0 && len(res.failed) == 0 && len(res.skipped) == 0 {
+		res.skipped = append(res.skipped, fmt.Sprintf("The schedule's creator doesn't have access to any hashlists tagged %q", schedule.HashlistTag))
+	}
+}
+
+func runSchedule(schedule *db.AttackSchedule) {
+	logger := log.WithField("schedule_id", schedule.ID.String()).WithField("schedule_name", schedule.Name)
+
+	claimed, err := db.ClaimAttackScheduleRun(schedule)
+	if err != nil {
+		logger.WithError(err).Error("Failed to claim scheduled run")
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	res := &runResult{}
+
+	creator, err := db.GetUserByID(schedule.CreatedByUserID.String())
+	switch {
+	case err == db.ErrNotFound:
+		res.failed = append(res.failed, "The schedule's creator no longer exists")
+	case err != nil:
+		res.failed = append(res.failed, "Failed to fetch the schedule's creator")
+	case config.Get().General.IsMaintenanceMode:
+		res.skipped = append(res.skipped, "Phatcrack was in maintenance mode")
+	case schedule.AttackID != nil:
+		runAttackSchedule(schedule, creator, res)
+	case schedule.AttackTemplateID != nil:
+		runTemplateSchedule(schedule, creator, res)
+	default:
+		res.failed = append(res.failed, "The schedule has nothing to run")
+	}
+
+	run := res.toRun(schedule)
+	err = db.CreateAttackScheduleRun(run)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record scheduled run")
+	}
+
+	logger.WithField("outcome", run.Outcome).WithField("attack_ids", run.AttackIDs).Info("Ran attack schedule")
+}
+
+func runDueSchedules() {
+	schedules, err := db.GetAllDueAttackSchedules()
+	if err != nil {
+		log.WithError(err).Error("Failed to get due attack schedules")
+		return
+	}
+
+	for i := range schedules {
+		runSchedule(&schedules[i])
+	}
+}
+
+var scheduleQueue = make(chan interface{}, 1)
+
+func scheduleTask() {
+	for {
+		select {
+		case <-time.After(scheduleInterval):
+		case <-scheduleQueue:
+		}
+
+		runDueSchedules()
+	}
+}
+
+// Requests that schedules are checked straight away, e.g. because one was just created to run now
+func QueueScheduleCheck() {
+	select {
+	case scheduleQueue <- nil:
+	default: // Channel already full, already been signalled, no need to block
+	}
+}
+
+// Schedules are persisted, so anything that came due while we were down is picked up on the first check
+func Setup() {
+	go scheduleTask()
+}
@@ -64,6 +64,18 @@ func NewRequestValidator() *RequestValidator {
 		return standardNameRegex.MatchString(name)
 	})
 
+	// Agent labels are free-form, but kept simple enough to read at a glance, e.g. site=dc1 or gpu:4090
+	agentLabelRegex := regexp.MustCompile(`^[\w\-\.=:]*$`)
+
+	v.Validator.RegisterValidation("agentlabel", func(fl validator.FieldLevel) bool {
+		label, ok := fl.Field().Interface().(string)
+		if !ok {
+			return false
+		}
+
+		return agentLabelRegex.MatchString(label)
+	})
+
 	usernameRegex := regexp.MustCompile(`^[\w\.@\-_]*$`)
 
 	v.Validator.RegisterValidation("username", func(fl validator.FieldLevel) bool {
@@ -94,6 +94,8 @@ func Listen(baseURL string, insecureOrigin bool, port string) error {
 	controllers.HookHashlistEndpoints(api.Group("/hashlist"))
 	controllers.HookAttackEndpoints(api.Group(("/attack")))
 	controllers.HookAttackTemplateEndpoints(api.Group(("/attack-template")))
+	controllers.HookAttackPipelineEndpoints(api.Group("/pipeline"))
+	controllers.HookAttackScheduleEndpoints(api.Group("/schedule"))
 	controllers.HookAgentEndpoints(api.Group("/agent"))
 	controllers.HookJobEndpoints(api.Group("/job"))
 	controllers.HookAccountEndpoints(api.Group("/account"))
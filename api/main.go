@@ -10,6 +10,7 @@ import (
 	"github.com/lachlan2k/phatcrack/api/internal/db"
 	"github.com/lachlan2k/phatcrack/api/internal/filerepo"
 	"github.com/lachlan2k/phatcrack/api/internal/fleet"
+	"github.com/lachlan2k/phatcrack/api/internal/scheduler"
 	"github.com/lachlan2k/phatcrack/api/internal/webserver"
 	log "github.com/sirupsen/logrus"
 )
@@ -86,6 +87,8 @@ func main() {
 		log.Fatal(err)
 	}
 
+	scheduler.Setup()
+
 	err = webserver.Listen(baseURL, insecureOrigin, port)
 	if err != nil {
 		log.Fatalf("couldn't run server: %v", err)
@@ -82,8 +82,50 @@ type AdminGetUserDTO struct {
 	Username         string   `json:"username"`
 	Roles            []string `json:"roles"`
 	IsPasswordLocked bool     `json:"is_password_locked"`
+	AgentPoolID      string   `json:"agent_pool_id"`
 }
 
 type AdminAgentSetMaintanceRequestDTO struct {
 	IsMaintenanceMode bool `json:"is_maintenance_mode"`
 }
+
+type AdminAgentSetMaxConcurrentJobsRequestDTO struct {
+	MaxConcurrentJobs int `json:"max_concurrent_jobs" validate:"min=0,max=64"`
+}
+
+type AdminAgentSetLabelsRequestDTO struct {
+	Labels []string `json:"labels" validate:"max=32,dive,required,agentlabel,max=64"`
+}
+
+type AdminAgentPoolCreateRequestDTO struct {
+	Name        string `json:"name" validate:"required,standardname,min=3,max=64"`
+	Description string `json:"description" validate:"printascii,max=1000"`
+}
+
+type AdminGetAllAgentPoolsResponseDTO struct {
+	AgentPools []AgentPoolDTO `json:"agent_pools"`
+}
+
+// An empty AgentPoolID takes whatever it is applied to out of its pool
+type AdminSetAgentPoolRequestDTO struct {
+	AgentPoolID string `json:"agent_pool_id" validate:"omitempty,uuid"`
+}
+
+type AdminAgentSetThermalPolicyRequestDTO struct {
+	TempAbort int    `json:"temp_abort" validate:"min=0,max=150"`
+	MaxTemp   int    `json:"max_temp" validate:"min=0,max=150"`
+	Action    string `json:"action" validate:"omitempty,oneof=pause kill"`
+}
+
+type AdminAgentDrainRequestDTO struct {
+	// If set, running jobs are paused and put back in the queue to carry on elsewhere, rather than left to finish
+	MigrateRunningJobs bool `json:"migrate_running_jobs"`
+}
+
+type AdminAgentBenchmarkRequestDTO struct {
+	HashTypes []uint `json:"hash_types" validate:"required,min=1,max=32"`
+}
+
+type AdminAttackSetPriorityRequestDTO struct {
+	Priority int `json:"priority" validate:"min=-100,max=100"`
+}
@@ -33,6 +33,7 @@ type AuthConfigDTO struct {
 type AgentConfigDTO struct {
 	AutomaticallySyncListfiles bool `json:"auto_sync_listfiles"`
 	SplitJobsPerAgent          int  `json:"split_jobs_per_agent"`
+	ChunksPerAgent             int  `json:"chunks_per_agent" validate:"min=0,max=1000"`
 }
 
 type GeneralConfigDTO struct {
@@ -6,8 +6,50 @@ type AgentDTO struct {
 	ID                string                             `json:"id"`
 	Name              string                             `json:"name"`
 	IsMaintenanceMode bool                               `json:"is_maintenance_mode"`
+	IsDraining        bool                               `json:"is_draining"`
+	IsDrained         bool                               `json:"is_drained"`
+	MaxConcurrentJobs int                                `json:"max_concurrent_jobs"`
+	JobSlots          int                                `json:"job_slots"`
 	AgentInfo         AgentInfoDTO                       `json:"agent_info"`
 	AgentDevices      []hashcattypes.HashcatStatusDevice `json:"agent_devices"`
+	AgentBenchmarks   []AgentBenchmarkDTO                `json:"agent_benchmarks"`
+	AgentCapabilities AgentCapabilitiesDTO               `json:"agent_capabilities"`
+	Labels            []string                           `json:"labels"`
+	AgentPoolID       string                             `json:"agent_pool_id"`
+	ThermalPolicy     AgentThermalPolicyDTO              `json:"thermal_policy"`
+}
+
+// What an admin has overridden in the agent's thermal policy, zero values are left up to the agent's config
+type AgentThermalPolicyDTO struct {
+	TempAbort int    `json:"temp_abort"`
+	MaxTemp   int    `json:"max_temp"`
+	Action    string `json:"action"`
+}
+
+type AgentPoolDTO struct {
+	ID          string `json:"id"`
+	TimeCreated int64  `json:"time_created"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type AgentCapabilitiesDTO struct {
+	HashcatVersion     string                              `json:"hashcat_version"`
+	OS                 string                              `json:"os"`
+	Arch               string                              `json:"arch"`
+	Devices            []hashcattypes.HashcatBackendDevice `json:"devices"`
+	SupportedHashTypes []uint                              `json:"supported_hash_types"`
+	ListfileDiskFree   uint64                              `json:"listfile_disk_free"`
+	Errors             []string                            `json:"errors"`
+	TimeReported       int64                               `json:"time_reported"`
+}
+
+type AgentBenchmarkDTO struct {
+	HashType uint                                  `json:"hash_type"`
+	Hashrate int64                                 `json:"hashrate"`
+	Devices  []hashcattypes.HashcatBenchmarkDevice `json:"devices"`
+	Time     int64                                 `json:"time"`
+	Error    string                                `json:"error"`
 }
 
 type AgentFileDTO struct {
@@ -21,6 +63,7 @@ type AgentInfoDTO struct {
 	LastCheckInTime    int64          `json:"last_checkin,omitempty"`
 	AvailableListfiles []AgentFileDTO `json:"available_listfiles,omitempty"`
 	ActiveJobIDs       []string       `json:"active_job_ids,omitempty"`
+	MaxConcurrentJobs  int            `json:"max_concurrent_jobs,omitempty"`
 }
 
 type AgentGetAllResponseDTO struct {
@@ -8,6 +8,34 @@ type AttackDTO struct {
 	HashcatParams  hashcattypes.HashcatParams `json:"hashcat_params"`
 	IsDistributed  bool                       `json:"is_distributed"`
 	ProgressString string                     `json:"progress_string"`
+	Priority       int                        `json:"priority"`
+	IsPaused       bool                       `json:"is_paused"`
+
+	IsChunked          bool  `json:"is_chunked"`
+	ChunkingActive     bool  `json:"chunking_active"`
+	Keyspace           int64 `json:"keyspace"`
+	KeyspaceDispatched int64 `json:"keyspace_dispatched"`
+
+	PipelineID string `json:"pipeline_id"`
+
+	Limits           AttackLimitsDTO `json:"limits"`
+	StartedAt        int64           `json:"started_at"`
+	LimitStopMessage string          `json:"limit_stop_message"`
+
+	AgentPlacement AgentPlacementDTO `json:"agent_placement"`
+}
+
+// Conditions for stopping an attack before it runs to completion. 0 means no limit
+type AttackLimitsDTO struct {
+	MaxRuntimeMinutes                int `json:"max_runtime_minutes" validate:"min=0"`
+	MaxEstimatedTimeRemainingMinutes int `json:"max_estimated_time_remaining_minutes" validate:"min=0"`
+	StopAtCrackedPercent             int `json:"stop_at_cracked_percent" validate:"min=0,max=100"`
+}
+
+// Labels an agent must have, or must not have, to be given the work
+type AgentPlacementDTO struct {
+	RequiredAgentLabels  []string `json:"required_agent_labels" validate:"max=16,dive,required,agentlabel,max=64"`
+	ForbiddenAgentLabels []string `json:"forbidden_agent_labels" validate:"max=16,dive,required,agentlabel,max=64"`
 }
 
 type AttackIDTreeDTO struct {
@@ -34,9 +62,47 @@ type AttackIDTreeMultipleDTO struct {
 }
 
 type AttackCreateRequestDTO struct {
-	HashlistID    string                     `json:"hashlist_id" validate:"required,uuid"`
-	HashcatParams hashcattypes.HashcatParams `json:"hashcat_params" validate:"required"`
-	IsDistributed bool                       `json:"is_distributed"`
+	HashlistID     string                     `json:"hashlist_id" validate:"required,uuid"`
+	HashcatParams  hashcattypes.HashcatParams `json:"hashcat_params" validate:"required"`
+	IsDistributed  bool                       `json:"is_distributed"`
+	Limits         AttackLimitsDTO            `json:"limits"`
+	AgentPlacement AgentPlacementDTO          `json:"agent_placement"`
+}
+
+type AttackCreateFromTemplateRequestDTO struct {
+	HashlistID       string `json:"hashlist_id" validate:"required,uuid"`
+	AttackTemplateID string `json:"attack_template_id" validate:"required,uuid"`
+	IsDistributed    bool   `json:"is_distributed"`
+	Start            bool   `json:"start"`
+}
+
+type AttackCreateFromTemplateResponseDTO struct {
+	AttackIDs []string `json:"attack_ids"`
+}
+
+type AttackEstimateRequestDTO struct {
+	HashlistID     string                     `json:"hashlist_id" validate:"required,uuid"`
+	HashcatParams  hashcattypes.HashcatParams `json:"hashcat_params" validate:"required"`
+	IsDistributed  bool                       `json:"is_distributed"`
+	AgentPlacement AgentPlacementDTO          `json:"agent_placement"`
+}
+
+type AttackEstimateShardDTO struct {
+	AgentID          string  `json:"agent_id"`
+	Keyspace         int64   `json:"keyspace"`
+	Candidates       float64 `json:"candidates"`
+	Hashrate         float64 `json:"hashrate"`
+	IsMeasured       bool    `json:"is_measured"`
+	EstimatedSeconds float64 `json:"estimated_seconds"`
+}
+
+type AttackEstimateResponseDTO struct {
+	Keyspace         int64                    `json:"keyspace"`
+	Candidates       float64                  `json:"candidates"`
+	Shards           []AttackEstimateShardDTO `json:"shards"`
+	Hashrate         float64                  `json:"hashrate"`
+	HasEstimate      bool                     `json:"has_estimate"`
+	EstimatedSeconds float64                  `json:"estimated_seconds"`
 }
 
 type AttackStartResponseDTO struct {
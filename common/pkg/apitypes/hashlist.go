@@ -6,6 +6,11 @@ type HashlistCreateRequestDTO struct {
 	HashType     int      `json:"hash_type" validate:"hashtype"`
 	InputHashes  []string `json:"input_hashes" validate:"required,min=1,dive,required,min=4"`
 	HasUsernames bool     `json:"has_usernames"`
+	Tags         []string `json:"tags" validate:"max=16,dive,required,standardname,max=32"`
+}
+
+type HashlistSetTagsRequestDTO struct {
+	Tags []string `json:"tags" validate:"max=16,dive,required,standardname,max=32"`
 }
 
 type HashlistAppendRequestDTO struct {
@@ -41,6 +46,7 @@ type HashlistDTO struct {
 	Hashes       []HashlistHashDTO `json:"hashes"`
 	Version      uint              `json:"version"`
 	HasUsernames bool              `json:"has_usernames"`
+	Tags         []string          `json:"tags"`
 }
 
 type HashlistResponseMultipleDTO struct {
@@ -28,6 +28,7 @@ type JobRuntimeOutputLineDTO struct {
 }
 
 type JobRuntimeDataDTO struct {
+	QueuedTime       time.Time `json:"queued_time"`
 	StartRequestTime time.Time `json:"start_request_time"`
 	StartedTime      time.Time `json:"started_time"`
 	StoppedTime      time.Time `json:"stopped_time"`
@@ -35,6 +36,8 @@ type JobRuntimeDataDTO struct {
 	StopReason       string    `json:"stop_reason"`
 	ErrorString      string    `json:"error_string"`
 	CmdLine          string    `json:"cmd_line"`
+	RestorePoint     int64     `json:"restore_point"`
+	RecoveryCount    int       `json:"recovery_count"`
 
 	OutputLines   []JobRuntimeOutputLineDTO    `json:"output_lines"`
 	StatusUpdates []hashcattypes.HashcatStatus `json:"status_updates"`
@@ -59,6 +62,7 @@ type JobDTO struct {
 	RuntimeData     JobRuntimeDataDTO          `json:"runtime_data"`
 	RuntimeSummary  JobRuntimeSummaryDTO       `json:"runtime_summary"`
 	AssignedAgentID string                     `json:"assigned_agent_id"`
+	AssignedDevices []int                      `json:"assigned_devices"`
 }
 
 type JobSimpleDTO struct {
@@ -0,0 +1,39 @@
+package apitypes
+
+import "github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+
+type AttackPipelineStageDTO struct {
+	HashcatParams hashcattypes.HashcatParams `json:"hashcat_params" validate:"required"`
+
+	// Use everything cracked in the hashlist so far as the stage's first wordlist
+	UseCrackedPlaintexts bool `json:"use_cracked_plaintexts"`
+}
+
+type AttackPipelineDTO struct {
+	ID          string `json:"id"`
+	HashlistID  string `json:"hashlist_id"`
+	Name        string `json:"name"`
+	TimeCreated int64  `json:"time_created"`
+
+	Stages        []AttackPipelineStageDTO `json:"stages"`
+	IsDistributed bool                     `json:"is_distributed"`
+
+	Status          string   `json:"status"`
+	StatusMessage   string   `json:"status_message"`
+	CurrentStage    int      `json:"current_stage"`
+	CurrentAttackID string   `json:"current_attack_id"`
+	AttackIDs       []string `json:"attack_ids"`
+
+	CreatedByUserID string `json:"created_by_user_id"`
+}
+
+type AttackPipelineMultipleDTO struct {
+	Pipelines []AttackPipelineDTO `json:"pipelines"`
+}
+
+type AttackPipelineCreateRequestDTO struct {
+	HashlistID    string                   `json:"hashlist_id" validate:"required,uuid"`
+	Name          string                   `json:"name" validate:"required,standardname,min=3,max=64"`
+	Stages        []AttackPipelineStageDTO `json:"stages" validate:"min=1,max=32,dive"`
+	IsDistributed bool                     `json:"is_distributed"`
+}
@@ -11,6 +11,9 @@ type ProjectDTO struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	OwnerUserID string `json:"owner_user_id"`
+
+	AgentPlacement AgentPlacementDTO `json:"agent_placement"`
+	AgentPoolID    string            `json:"agent_pool_id"`
 }
 
 type ProjectResponseMultipleDTO struct {
@@ -0,0 +1,57 @@
+package apitypes
+
+type AttackScheduleDTO struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	TimeCreated int64  `json:"time_created"`
+
+	AttackID         string `json:"attack_id"`
+	AttackTemplateID string `json:"attack_template_id"`
+	HashlistTag      string `json:"hashlist_tag"`
+	IsDistributed    bool   `json:"is_distributed"`
+
+	IsEnabled             bool  `json:"is_enabled"`
+	NextRunAt             int64 `json:"next_run_at"`
+	RepeatIntervalMinutes int   `json:"repeat_interval_minutes"`
+
+	LastRunAt   int64  `json:"last_run_at"`
+	LastOutcome string `json:"last_outcome"`
+
+	CreatedByUserID string `json:"created_by_user_id"`
+}
+
+type AttackScheduleMultipleDTO struct {
+	Schedules []AttackScheduleDTO `json:"schedules"`
+}
+
+type AttackScheduleRunDTO struct {
+	ID               string   `json:"id"`
+	AttackScheduleID string   `json:"attack_schedule_id"`
+	TimeRan          int64    `json:"time_ran"`
+	Outcome          string   `json:"outcome"`
+	Message          string   `json:"message"`
+	AttackIDs        []string `json:"attack_ids"`
+}
+
+type AttackScheduleRunMultipleDTO struct {
+	Runs []AttackScheduleRunDTO `json:"runs"`
+}
+
+// Either AttackID, or AttackTemplateID and HashlistTag, should be given
+type AttackScheduleCreateRequestDTO struct {
+	Name string `json:"name" validate:"required,standardname,min=3,max=64"`
+
+	AttackID         string `json:"attack_id" validate:"omitempty,uuid"`
+	AttackTemplateID string `json:"attack_template_id" validate:"omitempty,uuid"`
+	HashlistTag      string `json:"hashlist_tag" validate:"omitempty,standardname,max=32"`
+	IsDistributed    bool   `json:"is_distributed"`
+
+	// Unix timestamp of the first run
+	StartAt int64 `json:"start_at" validate:"required"`
+	// 0 means the schedule only runs once
+	RepeatIntervalMinutes int `json:"repeat_interval_minutes" validate:"min=0,max=525600"`
+}
+
+type AttackScheduleSetEnabledRequestDTO struct {
+	IsEnabled bool `json:"is_enabled"`
+}
@@ -6,4 +6,6 @@ const (
 	AttackModeMask       = 3
 	AttackModeHybridDM   = 6
 	AttackModeHybridMD   = 7
+	// Each hash is paired with its own line of the wordlist
+	AttackModeAssociation = 9
 )
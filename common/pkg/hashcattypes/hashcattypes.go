@@ -1,6 +1,9 @@
 package hashcattypes
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type HashcatParams struct {
 	AttackMode uint8 `json:"attack_mode"`
@@ -22,6 +25,45 @@ type HashcatParams struct {
 
 	Skip  int64 `json:"skip"`
 	Limit int64 `json:"limit"`
+
+	BackendDevices []int `json:"backend_devices"` // Internal use: the agent's devices the dispatcher gave the job, empty means all of them
+}
+
+func (params HashcatParams) Validate() error {
+	switch params.AttackMode {
+	case AttackModeDictionary:
+		if len(params.WordlistFilenames) != 1 {
+			return fmt.Errorf("expected 1 wordlist for dictionary attack (%d), but %d given", AttackModeDictionary, len(params.WordlistFilenames))
+		}
+
+	case AttackModeCombinator:
+		if len(params.WordlistFilenames) != 2 {
+			return fmt.Errorf("expected 2 wordlists for combinator attack (%d), but %d given", AttackModeCombinator, len(params.WordlistFilenames))
+		}
+
+	case AttackModeMask:
+		if params.Mask == "" {
+			return fmt.Errorf("using mask attack (%d), but no mask was given", AttackModeMask)
+		}
+
+	case AttackModeHybridDM, AttackModeHybridMD:
+		if params.Mask == "" {
+			return fmt.Errorf("using hybrid attack (%d), but no mask was given", params.AttackMode)
+		}
+		if len(params.WordlistFilenames) != 1 {
+			return fmt.Errorf("using hybrid attack (%d), but %d wordlist were given", params.AttackMode, len(params.WordlistFilenames))
+		}
+
+	case AttackModeAssociation:
+		if len(params.WordlistFilenames) != 1 {
+			return fmt.Errorf("expected 1 hint wordlist for association attack (%d), but %d given", AttackModeAssociation, len(params.WordlistFilenames))
+		}
+
+	default:
+		return fmt.Errorf("unsupported attack mode %d", params.AttackMode)
+	}
+
+	return nil
 }
 
 type HashcatStatusGuess struct {
@@ -47,6 +89,28 @@ type HashcatStatusDevice struct {
 	Temp       int    `json:"temp"`
 }
 
+// One device's line of `hashcat -b --machine-readable` output
+type HashcatBenchmarkDevice struct {
+	DeviceID      int     `json:"device_id"`
+	Speed         int64   `json:"speed"`
+	ExecRuntimeMs float64 `json:"exec_runtime_ms"`
+}
+
+// A device as listed by `hashcat -I`
+type HashcatBackendDevice struct {
+	DeviceID      int    `json:"device_id"`
+	Backend       string `json:"backend"`
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	Vendor        string `json:"vendor"`
+	Processors    int    `json:"processors"`
+	ClockMHz      int    `json:"clock_mhz"`
+	MemoryTotalMB int64  `json:"memory_total_mb"`
+	DriverVersion string `json:"driver_version"`
+	// Set if this is the same physical device as another one, found through a different backend
+	AliasOf int `json:"alias_of"`
+}
+
 type HashcatStatus struct {
 	OriginalLine string    `json:"original_line"`
 	Time         time.Time `json:"time"`
@@ -8,16 +8,20 @@ import (
 
 const (
 	// server -> agent types
-	JobStartType = "JobStart"
-	JobKillType  = "JobKill"
+	JobStartType          = "JobStart"
+	JobKillType           = "JobKill"
+	JobPauseType          = "JobPause"
+	JobResumeType         = "JobResume"
+	JobCrackedHashAckType = "JobCrackedHashAck"
 
 	// agent -> server types
-	JobStartedType       = "JobStarted"
-	JobFailedToStartType = "JobFailedToStart"
-	JobCrackedHashType   = "JobCrackedHash"
-	JobStdLineType       = "JobStdLine"
-	JobExitedType        = "JobExited"
-	JobStatusUpdateType  = "JobStatusUpdate"
+	JobStartedType          = "JobStarted"
+	JobFailedToStartType    = "JobFailedToStart"
+	JobCrackedHashType      = "JobCrackedHash"
+	JobCrackedHashBatchType = "JobCrackedHashBatch"
+	JobStdLineType          = "JobStdLine"
+	JobExitedType           = "JobExited"
+	JobStatusUpdateType     = "JobStatusUpdate"
 )
 
 // JobStart
@@ -25,6 +29,8 @@ type JobStartDTO struct {
 	ID            string                     `json:"id"`
 	HashcatParams hashcattypes.HashcatParams `json:"hashcat_parms"`
 	TargetHashes  []string                   `json:"target_hashes"`
+	// For association attacks, the hint for each of TargetHashes, in the same order
+	AssociatedHints []string `json:"associated_hints"`
 }
 
 // JobFailedToStart
@@ -46,10 +52,44 @@ type JobKillDTO struct {
 	StopReason string `json:"stop_reason"`
 }
 
+// JobPause
+type JobPauseDTO struct {
+	JobID string `json:"job_id"`
+}
+
+// JobResume, tells a restarted agent to pick a job back up from its checkpoint
+// Sending a JobKill instead tells it to throw the checkpoint away
+type JobResumeDTO struct {
+	JobID string `json:"job_id"`
+}
+
+// A job the agent was running when it was restarted, which it has a checkpoint for
+type RecoverableJobDTO struct {
+	JobID        string    `json:"job_id"`
+	RestorePoint int64     `json:"restore_point"`
+	Time         time.Time `json:"time"`
+}
+
 // JobCrackedHash
 type JobCrackedHashDTO struct {
 	JobID  string                     `json:"job_id"`
 	Result hashcattypes.HashcatResult `json:"result"`
+	// Numbered by the agent so the server can acknowledge it. The agent keeps it spooled on disk, and sends it again after reconnecting, until it's acknowledged
+	// Zero means the agent doesn't want an acknowledgement
+	Seq uint64 `json:"seq"`
+}
+
+// JobCrackedHashBatch, the cracked hashes from a short window of a job, so fast hash types don't need a message each
+// Numbered and acknowledged the same way as JobCrackedHash, from the same sequence
+type JobCrackedHashBatchDTO struct {
+	JobID   string                       `json:"job_id"`
+	Results []hashcattypes.HashcatResult `json:"results"`
+	Seq     uint64                       `json:"seq"`
+}
+
+// JobCrackedHashAck, the server has stored the cracked hash (or batch) the agent numbered Seq
+type JobCrackedHashAckDTO struct {
+	Seq uint64 `json:"seq"`
 }
 
 // JobStdLine
@@ -65,11 +105,18 @@ type JobStdLineDTO struct {
 }
 
 // JobExited
+// The agent stopped the job because one of its devices went over the thermal policy's MaxTemp
+const JobStopReasonThermalLimit = "JobStopReason-ThermalLimit"
+
 type JobExitedDTO struct {
 	JobID      string    `json:"job_id"`
 	Time       time.Time `json:"time"`
 	Error      string    `json:"error"`
 	StopReason string    `json:"stop_reason"`
+
+	// Set if the job exited because it was asked to pause, RestorePoint is where it should pick up from
+	Paused       bool  `json:"paused"`
+	RestorePoint int64 `json:"restore_point"`
 }
 
 // JobStatusUpdate
@@ -1,15 +1,26 @@
 package wstypes
 
+import (
+	"time"
+
+	"github.com/lachlan2k/phatcrack/common/pkg/hashcattypes"
+)
+
 type Message struct {
 	Type    string `json:"type"`
 	Payload string `json:"payload"` // json blob
 }
 
 const (
+	AgentHelloType          = "AgentHello"
 	HeartbeatType           = "Heartbeat"
 	AgentErrorType          = "AgentError"
 	DownloadFileRequestType = "DownloadFileRequest"
 	DeleteFileRequestType   = "DeleteFileRequest"
+	BenchmarkRequestType    = "BenchmarkRequest"
+	BenchmarkResultType     = "BenchmarkResult"
+	ThermalPolicyType       = "ThermalPolicy"
+	ThermalEventType        = "ThermalEvent"
 )
 
 type FileDTO struct {
@@ -17,6 +28,23 @@ type FileDTO struct {
 	Size int64  `json:"size"`
 }
 
+// AgentHello, sent every time the agent (re)connects
+type AgentHelloDTO struct {
+	Version            string                              `json:"version"`
+	HashcatVersion     string                              `json:"hashcat_version"`
+	OS                 string                              `json:"os"`
+	Arch               string                              `json:"arch"`
+	Devices            []hashcattypes.HashcatBackendDevice `json:"devices"`
+	SupportedHashTypes []uint                              `json:"supported_hash_types"`
+	ListfileDiskFree   uint64                              `json:"listfile_disk_free"`
+
+	// Anything that went wrong working the above out, so the rest can still be reported
+	Errors []string `json:"errors"`
+
+	// Jobs that were running when the agent was last restarted, which it can pick back up
+	RecoverableJobs []RecoverableJobDTO `json:"recoverable_jobs"`
+}
+
 type HeartbeatDTO struct {
 	Time              int64     `json:"time"`
 	Version           string    `json:"version"`
@@ -24,6 +52,7 @@ type HeartbeatDTO struct {
 	ActiveJobIDs      []string  `json:"active_job_ids"`
 	Listfiles         []FileDTO `json:"listifles"`
 	IsDownloadingFile bool      `json:"is_downloading_file"`
+	MaxConcurrentJobs int       `json:"max_concurrent_jobs"`
 }
 
 type DownloadFileRequestDTO struct {
@@ -37,3 +66,43 @@ type DeleteFileRequestDTO struct {
 type AgentErrorDTO struct {
 	Error string `json:"error"`
 }
+
+// BenchmarkRequest
+type BenchmarkRequestDTO struct {
+	HashType uint `json:"hash_type"`
+}
+
+// BenchmarkResult
+type BenchmarkResultDTO struct {
+	HashType uint                                  `json:"hash_type"`
+	Time     time.Time                             `json:"time"`
+	Devices  []hashcattypes.HashcatBenchmarkDevice `json:"devices"`
+	Error    string                                `json:"error"`
+}
+
+const (
+	ThermalActionPause = "pause"
+	ThermalActionKill  = "kill"
+)
+
+// ThermalPolicy, sent by the server to override what's in the agent's config
+// Zero values leave the agent's own setting alone
+type ThermalPolicyDTO struct {
+	// Passed to hashcat as --hwmon-temp-abort, so hashcat itself gives up at this temperature (in °C)
+	TempAbort int `json:"temp_abort"`
+	// The agent stops a job as soon as one of its devices reports this temperature (in °C)
+	MaxTemp int `json:"max_temp"`
+	// ThermalActionPause or ThermalActionKill, what to do with a job that goes over MaxTemp
+	Action string `json:"action"`
+}
+
+// ThermalEvent, sent when the agent has stopped a job for getting too hot
+type ThermalEventDTO struct {
+	JobID      string    `json:"job_id"`
+	DeviceID   int       `json:"device_id"`
+	DeviceName string    `json:"device_name"`
+	Temp       int       `json:"temp"`
+	MaxTemp    int       `json:"max_temp"`
+	Action     string    `json:"action"`
+	Time       time.Time `json:"time"`
+}
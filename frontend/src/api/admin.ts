@@ -1,20 +1,30 @@
 import type {
+  AdminAgentBenchmarkRequestDTO,
   AdminAgentCreateRequestDTO,
   AdminAgentCreateResponseDTO,
+  AdminAgentDrainRequestDTO,
+  AdminAgentPoolCreateRequestDTO,
   AdminAgentRegistrationKeyCreateRequestDTO,
   AdminAgentRegistrationKeyCreateResponseDTO,
   AdminAgentSetMaintanceRequestDTO,
+  AdminAgentSetLabelsRequestDTO,
+  AdminAgentSetMaxConcurrentJobsRequestDTO,
+  AdminAgentSetThermalPolicyRequestDTO,
+  AdminAttackSetPriorityRequestDTO,
   AdminConfigRequestDTO,
   AdminConfigResponseDTO,
+  AdminGetAllAgentPoolsResponseDTO,
   AdminGetAllAgentRegistrationKeysResponseDTO,
   AdminGetAllUsersResponseDTO,
   AdminServiceAccountCreateRequestDTO,
+  AdminSetAgentPoolRequestDTO,
   AdminServiceAccountCreateResponseDTO,
   AdminUserCreateRequestDTO,
   AdminUserCreateResponseDTO,
   AdminUserUpdatePasswordRequestDTO,
   AdminUserUpdatePasswordResponseDTO,
   AdminUserUpdateRequestDTO,
+  AgentPoolDTO,
   UserDTO
 } from './types'
 
@@ -60,6 +70,34 @@ export function adminAgentSetMaintenance(id: string, body: AdminAgentSetMaintanc
   return client.put(`/api/v1/admin/agent/${id}/set-maintenance-mode`, body).then(res => res.data)
 }
 
+export function adminAgentDrain(id: string, body: AdminAgentDrainRequestDTO): Promise<string> {
+  return client.post(`/api/v1/admin/agent/${id}/drain`, body).then(res => res.data)
+}
+
+export function adminAgentUndrain(id: string): Promise<string> {
+  return client.post(`/api/v1/admin/agent/${id}/undrain`).then(res => res.data)
+}
+
+export function adminAgentSetThermalPolicy(id: string, body: AdminAgentSetThermalPolicyRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/agent/${id}/set-thermal-policy`, body).then(res => res.data)
+}
+
+export function adminAgentSetMaxConcurrentJobs(id: string, body: AdminAgentSetMaxConcurrentJobsRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/agent/${id}/set-max-concurrent-jobs`, body).then(res => res.data)
+}
+
+export function adminAgentSetLabels(id: string, body: AdminAgentSetLabelsRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/agent/${id}/set-labels`, body).then(res => res.data)
+}
+
+export function adminAgentBenchmark(id: string, body: AdminAgentBenchmarkRequestDTO): Promise<string> {
+  return client.post(`/api/v1/admin/agent/${id}/benchmark`, body).then(res => res.data)
+}
+
+export function adminAttackSetPriority(id: string, body: AdminAttackSetPriorityRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/attack/${id}/set-priority`, body).then(res => res.data)
+}
+
 export function adminGetConfig(): Promise<AdminConfigResponseDTO> {
   return client.get('/api/v1/admin/config').then(res => res.data)
 }
@@ -85,3 +123,27 @@ export function adminCreateAgentRegistrationKey(
 export function adminDeleteAgentRegistrationKey(id: string): Promise<string> {
   return client.delete(`/api/v1/admin/agent-registration-key/${id}`).then(res => res.data)
 }
+
+export function adminGetAgentPools(): Promise<AdminGetAllAgentPoolsResponseDTO> {
+  return client.get('/api/v1/admin/agent-pool/all').then(res => res.data)
+}
+
+export function adminCreateAgentPool(body: AdminAgentPoolCreateRequestDTO): Promise<AgentPoolDTO> {
+  return client.post('/api/v1/admin/agent-pool/create', body).then(res => res.data)
+}
+
+export function adminDeleteAgentPool(id: string): Promise<string> {
+  return client.delete(`/api/v1/admin/agent-pool/${id}`).then(res => res.data)
+}
+
+export function adminAgentSetAgentPool(id: string, body: AdminSetAgentPoolRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/agent/${id}/set-agent-pool`, body).then(res => res.data)
+}
+
+export function adminProjectSetAgentPool(id: string, body: AdminSetAgentPoolRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/project/${id}/set-agent-pool`, body).then(res => res.data)
+}
+
+export function adminUserSetAgentPool(id: string, body: AdminSetAgentPoolRequestDTO): Promise<string> {
+  return client.put(`/api/v1/admin/user/${id}/set-agent-pool`, body).then(res => res.data)
+}
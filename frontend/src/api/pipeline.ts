@@ -0,0 +1,24 @@
+import type { AttackPipelineCreateRequestDTO, AttackPipelineDTO, AttackPipelineMultipleDTO } from './types'
+
+import { client } from '.'
+
+export const AttackPipelineStatusRunning = 'AttackPipelineStatus-Running'
+export const AttackPipelineStatusFinished = 'AttackPipelineStatus-Finished'
+export const AttackPipelineStatusStopped = 'AttackPipelineStatus-Stopped'
+export const AttackPipelineStatusFailed = 'AttackPipelineStatus-Failed'
+
+export function createAttackPipeline(body: AttackPipelineCreateRequestDTO): Promise<AttackPipelineDTO> {
+  return client.post('/api/v1/pipeline/create', body).then(res => res.data)
+}
+
+export function getAttackPipeline(pipelineId: string): Promise<AttackPipelineDTO> {
+  return client.get(`/api/v1/pipeline/${pipelineId}`).then(res => res.data)
+}
+
+export function getAttackPipelinesForHashlist(hashlistId: string): Promise<AttackPipelineMultipleDTO> {
+  return client.get(`/api/v1/hashlist/${hashlistId}/pipelines`).then(res => res.data)
+}
+
+export function stopAttackPipeline(pipelineId: string): Promise<string> {
+  return client.delete(`/api/v1/pipeline/${pipelineId}/stop`).then(res => res.data)
+}
@@ -1,6 +1,8 @@
 import type {
+  AgentPlacementDTO,
   AttackDTO,
   AttackIDTreeMultipleDTO,
+  AttackLimitsDTO,
   AttackMultipleDTO,
   AttackStartResponseDTO,
   AttackWithJobsMultipleDTO,
@@ -8,11 +10,16 @@ import type {
   HashlistAppendResponseDTO,
   HashlistDTO,
   HashlistResponseMultipleDTO,
+  HashlistSetTagsRequestDTO,
   ProjectAddShareRequestDTO,
   ProjectSharesDTO,
   RunningJobCountPerUsersDTO,
   RunningJobsForUserResponseDTO,
   AttackCreateRequestDTO,
+  AttackCreateFromTemplateRequestDTO,
+  AttackCreateFromTemplateResponseDTO,
+  AttackEstimateRequestDTO,
+  AttackEstimateResponseDTO,
   HashlistCreateRequestDTO,
   HashlistCreateResponseDTO,
   ProjectCreateRequestDTO,
@@ -35,6 +42,10 @@ export function deleteProject(projId: string): Promise<string> {
   return client.delete(`/api/v1/project/${projId}`).then(res => res.data)
 }
 
+export function setProjectAgentPlacement(projId: string, placement: AgentPlacementDTO): Promise<string> {
+  return client.put(`/api/v1/project/${projId}/agent-placement`, placement).then(res => res.data)
+}
+
 export function getAllProjects(): Promise<ProjectResponseMultipleDTO> {
   return client.get('/api/v1/project/all').then(res => res.data)
 }
@@ -67,10 +78,26 @@ export function appendToHashlist(hashlistId: string, hashes: string[]): Promise<
     .then(res => res.data)
 }
 
+export function setHashlistTags(hashlistId: string, tags: string[]): Promise<HashlistDTO> {
+  return client
+    .put(`/api/v1/hashlist/${hashlistId}/tags`, {
+      tags
+    } as HashlistSetTagsRequestDTO)
+    .then(res => res.data)
+}
+
 export function createAttack(body: AttackCreateRequestDTO): Promise<AttackDTO> {
   return client.post(`/api/v1/attack/create`, body).then(res => res.data)
 }
 
+export function createAttacksFromTemplate(body: AttackCreateFromTemplateRequestDTO): Promise<AttackCreateFromTemplateResponseDTO> {
+  return client.post(`/api/v1/attack/create-from-template`, body).then(res => res.data)
+}
+
+export function estimateAttack(body: AttackEstimateRequestDTO): Promise<AttackEstimateResponseDTO> {
+  return client.post(`/api/v1/attack/estimate`, body).then(res => res.data)
+}
+
 export function deleteAttack(attackId: string): Promise<string> {
   return client.delete(`/api/v1/attack/${attackId}`).then(res => res.data)
 }
@@ -83,6 +110,22 @@ export function startAttack(attackId: string): Promise<AttackStartResponseDTO> {
   return client.put(`/api/v1/attack/${attackId}/start`).then(res => res.data)
 }
 
+export function pauseAttack(attackId: string): Promise<string> {
+  return client.put(`/api/v1/attack/${attackId}/pause`).then(res => res.data)
+}
+
+export function resumeAttack(attackId: string): Promise<string> {
+  return client.put(`/api/v1/attack/${attackId}/resume`).then(res => res.data)
+}
+
+export function setAttackLimits(attackId: string, limits: AttackLimitsDTO): Promise<string> {
+  return client.put(`/api/v1/attack/${attackId}/limits`, limits).then(res => res.data)
+}
+
+export function setAttackAgentPlacement(attackId: string, placement: AgentPlacementDTO): Promise<string> {
+  return client.put(`/api/v1/attack/${attackId}/agent-placement`, placement).then(res => res.data)
+}
+
 export function restartAttackFailedJobs(attackId: string): Promise<string> {
   return client.put(`/api/v1/attack/${attackId}/restart-failed-jobs`).then(res => res.data)
 }
@@ -122,8 +165,10 @@ export function getJobCountPerUser(): Promise<RunningJobCountPerUsersDTO> {
 }
 
 export const JobStatusCreated = 'JobStatus-Created'
+export const JobStatusQueued = 'JobStatus-Queued'
 export const JobStatusAwaitingStart = 'JobStatus-AwaitingStart'
 export const JobStatusStarted = 'JobStatus-Started'
+export const JobStatusPaused = 'JobStatus-Paused'
 export const JobStatusExited = 'JobStatus-Exited'
 
 // Clean exit
@@ -136,3 +181,7 @@ export const JobStopReasonFailedToStart = 'JobStopReason-FailedToStart'
 export const JobStopReasonFailed = 'JobStopReason-Failed'
 // Agent timed out and we lost contact
 export const JobStopReasonTimeout = 'JobStopReason-Timeout'
+// The attack went over one of its limits, e.g. how long it was allowed to run for
+export const JobStopReasonBudgetExceeded = 'JobStopReason-BudgetExceeded'
+// One of the agent's devices got too hot, so the agent stopped it
+export const JobStopReasonThermalLimit = 'JobStopReason-ThermalLimit'
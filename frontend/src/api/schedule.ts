@@ -0,0 +1,37 @@
+import type {
+  AttackScheduleCreateRequestDTO,
+  AttackScheduleDTO,
+  AttackScheduleMultipleDTO,
+  AttackScheduleRunMultipleDTO,
+  AttackScheduleSetEnabledRequestDTO
+} from './types'
+
+import { client } from '.'
+
+export const AttackScheduleOutcomeStarted = 'AttackScheduleOutcome-Started'
+export const AttackScheduleOutcomeSkipped = 'AttackScheduleOutcome-Skipped'
+export const AttackScheduleOutcomeFailed = 'AttackScheduleOutcome-Failed'
+
+export function getAllAttackSchedules(): Promise<AttackScheduleMultipleDTO> {
+  return client.get('/api/v1/schedule/all').then(res => res.data)
+}
+
+export function createAttackSchedule(body: AttackScheduleCreateRequestDTO): Promise<AttackScheduleDTO> {
+  return client.post('/api/v1/schedule/create', body).then(res => res.data)
+}
+
+export function setAttackScheduleEnabled(scheduleId: string, isEnabled: boolean): Promise<AttackScheduleDTO> {
+  return client
+    .put(`/api/v1/schedule/${scheduleId}/enabled`, {
+      is_enabled: isEnabled
+    } as AttackScheduleSetEnabledRequestDTO)
+    .then(res => res.data)
+}
+
+export function deleteAttackSchedule(scheduleId: string): Promise<string> {
+  return client.delete(`/api/v1/schedule/${scheduleId}`).then(res => res.data)
+}
+
+export function getAttackScheduleRuns(scheduleId: string): Promise<AttackScheduleRunMultipleDTO> {
+  return client.get(`/api/v1/schedule/${scheduleId}/runs`).then(res => res.data)
+}
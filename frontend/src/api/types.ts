@@ -28,6 +28,7 @@ export interface AuthConfigDTO {
 export interface AgentConfigDTO {
   auto_sync_listfiles: boolean
   split_jobs_per_agent: number
+  chunks_per_agent: number
 }
 export interface GeneralConfigDTO {
   is_maintenance_mode: boolean
@@ -111,6 +112,7 @@ export interface AdminGetUserDTO {
   username: string
   roles: string[]
   is_password_locked: boolean
+  agent_pool_id: string
 }
 export interface AdminGetAllUsersResponseDTO {
   users: AdminGetUserDTO[]
@@ -119,6 +121,36 @@ export interface AdminGetAllUsersResponseDTO {
 export interface AdminAgentSetMaintanceRequestDTO {
   is_maintenance_mode: boolean
 }
+export interface AdminAgentSetMaxConcurrentJobsRequestDTO {
+  max_concurrent_jobs: number
+}
+export interface AdminAgentSetLabelsRequestDTO {
+  labels: string[]
+}
+export interface AdminAgentPoolCreateRequestDTO {
+  name: string
+  description: string
+}
+export interface AdminGetAllAgentPoolsResponseDTO {
+  agent_pools: AgentPoolDTO[]
+}
+export interface AdminSetAgentPoolRequestDTO {
+  agent_pool_id: string
+}
+export interface AdminAgentSetThermalPolicyRequestDTO {
+  temp_abort: number
+  max_temp: number
+  action: string
+}
+export interface AdminAgentDrainRequestDTO {
+  migrate_running_jobs: boolean
+}
+export interface AdminAgentBenchmarkRequestDTO {
+  hash_types: number[]
+}
+export interface AdminAttackSetPriorityRequestDTO {
+  priority: number
+}
 export interface HashcatStatusDevice {
   device_id: number
   device_name: string
@@ -127,6 +159,23 @@ export interface HashcatStatusDevice {
   util: number
   temp: number
 }
+export interface HashcatBenchmarkDevice {
+  device_id: number
+  speed: number
+  exec_runtime_ms: number
+}
+export interface HashcatBackendDevice {
+  device_id: number
+  backend: string
+  type: string
+  name: string
+  vendor: string
+  processors: number
+  clock_mhz: number
+  memory_total_mb: number
+  driver_version: string
+  alias_of: number
+}
 export interface AgentFileDTO {
   name: string
   size: number
@@ -137,13 +186,51 @@ export interface AgentInfoDTO {
   last_checkin?: number
   available_listfiles?: AgentFileDTO[]
   active_job_ids?: string[]
+  max_concurrent_jobs?: number
 }
 export interface AgentDTO {
   id: string
   name: string
   is_maintenance_mode: boolean
+  is_draining: boolean
+  is_drained: boolean
+  max_concurrent_jobs: number
+  job_slots: number
   agent_info: AgentInfoDTO
   agent_devices: HashcatStatusDevice[]
+  agent_benchmarks: AgentBenchmarkDTO[]
+  agent_capabilities: AgentCapabilitiesDTO
+  labels: string[]
+  agent_pool_id: string
+  thermal_policy: AgentThermalPolicyDTO
+}
+export interface AgentThermalPolicyDTO {
+  temp_abort: number
+  max_temp: number
+  action: string
+}
+export interface AgentPoolDTO {
+  id: string
+  time_created: number
+  name: string
+  description: string
+}
+export interface AgentCapabilitiesDTO {
+  hashcat_version: string
+  os: string
+  arch: string
+  devices: HashcatBackendDevice[]
+  supported_hash_types: number[]
+  listfile_disk_free: number
+  errors: string[]
+  time_reported: number
+}
+export interface AgentBenchmarkDTO {
+  hash_type: number
+  hashrate: number
+  devices: HashcatBenchmarkDevice[]
+  time: number
+  error: string
 }
 
 export interface AgentGetAllResponseDTO {
@@ -174,6 +261,7 @@ export interface HashcatParams {
   enable_loopback: boolean
   skip: number
   limit: number
+  backend_devices: number[]
 }
 export interface AttackDTO {
   id: string
@@ -181,6 +269,26 @@ export interface AttackDTO {
   hashcat_params: HashcatParams
   is_distributed: boolean
   progress_string: string
+  priority: number
+  is_paused: boolean
+  is_chunked: boolean
+  chunking_active: boolean
+  keyspace: number
+  keyspace_dispatched: number
+  pipeline_id: string
+  limits: AttackLimitsDTO
+  started_at: number
+  limit_stop_message: string
+  agent_placement: AgentPlacementDTO
+}
+export interface AttackLimitsDTO {
+  max_runtime_minutes: number
+  max_estimated_time_remaining_minutes: number
+  stop_at_cracked_percent: number
+}
+export interface AgentPlacementDTO {
+  required_agent_labels: string[]
+  forbidden_agent_labels: string[]
 }
 export interface AttackIDTreeDTO {
   project_id: string
@@ -228,6 +336,7 @@ export interface JobRuntimeOutputLineDTO {
 }
 export interface Time {}
 export interface JobRuntimeDataDTO {
+  queued_time: Time
   start_request_time: Time
   started_time: Time
   stopped_time: Time
@@ -235,6 +344,8 @@ export interface JobRuntimeDataDTO {
   stop_reason: string
   error_string: string
   cmd_line: string
+  restore_point: number
+  recovery_count: number
   output_lines: JobRuntimeOutputLineDTO[]
   status_updates: HashcatStatus[]
 }
@@ -248,6 +359,7 @@ export interface JobDTO {
   runtime_data: JobRuntimeDataDTO
   runtime_summary: JobRuntimeSummaryDTO
   assigned_agent_id: string
+  assigned_devices: number[]
 }
 export interface AttackWithJobsDTO {
   id: string
@@ -255,6 +367,17 @@ export interface AttackWithJobsDTO {
   hashcat_params: HashcatParams
   is_distributed: boolean
   progress_string: string
+  priority: number
+  is_paused: boolean
+  is_chunked: boolean
+  chunking_active: boolean
+  keyspace: number
+  keyspace_dispatched: number
+  pipeline_id: string
+  limits: AttackLimitsDTO
+  started_at: number
+  limit_stop_message: string
+  agent_placement: AgentPlacementDTO
   jobs: JobDTO[]
 }
 export interface AttackWithJobsMultipleDTO {
@@ -270,6 +393,39 @@ export interface AttackCreateRequestDTO {
   hashlist_id: string
   hashcat_params: HashcatParams
   is_distributed: boolean
+  limits: AttackLimitsDTO
+  agent_placement: AgentPlacementDTO
+}
+export interface AttackCreateFromTemplateRequestDTO {
+  hashlist_id: string
+  attack_template_id: string
+  is_distributed: boolean
+  start: boolean
+}
+export interface AttackCreateFromTemplateResponseDTO {
+  attack_ids: string[]
+}
+export interface AttackEstimateRequestDTO {
+  hashlist_id: string
+  hashcat_params: HashcatParams
+  is_distributed: boolean
+  agent_placement: AgentPlacementDTO
+}
+export interface AttackEstimateShardDTO {
+  agent_id: string
+  keyspace: number
+  candidates: number
+  hashrate: number
+  is_measured: boolean
+  estimated_seconds: number
+}
+export interface AttackEstimateResponseDTO {
+  keyspace: number
+  candidates: number
+  shards: AttackEstimateShardDTO[]
+  hashrate: number
+  has_estimate: boolean
+  estimated_seconds: number
 }
 export interface AttackStartResponseDTO {
   new_job_ids: string[]
@@ -448,6 +604,10 @@ export interface HashlistCreateRequestDTO {
   hash_type: number
   input_hashes: string[]
   has_usernames: boolean
+  tags: string[]
+}
+export interface HashlistSetTagsRequestDTO {
+  tags: string[]
 }
 export interface HashlistAppendRequestDTO {
   input_hashes: string[]
@@ -478,6 +638,7 @@ export interface HashlistDTO {
   hashes: HashlistHashDTO[]
   version: number
   has_usernames: boolean
+  tags: string[]
 }
 export interface HashlistResponseMultipleDTO {
   hashlists: HashlistDTO[]
@@ -545,6 +706,33 @@ export interface GetAllListfilesDTO {
 export interface ListfileUploadResponseDTO {
   listfile: ListfileDTO
 }
+export interface AttackPipelineStageDTO {
+  hashcat_params: HashcatParams
+  use_cracked_plaintexts: boolean
+}
+export interface AttackPipelineDTO {
+  id: string
+  hashlist_id: string
+  name: string
+  time_created: number
+  stages: AttackPipelineStageDTO[]
+  is_distributed: boolean
+  status: string
+  status_message: string
+  current_stage: number
+  current_attack_id: string
+  attack_ids: string[]
+  created_by_user_id: string
+}
+export interface AttackPipelineMultipleDTO {
+  pipelines: AttackPipelineDTO[]
+}
+export interface AttackPipelineCreateRequestDTO {
+  hashlist_id: string
+  name: string
+  stages: AttackPipelineStageDTO[]
+  is_distributed: boolean
+}
 export interface PotfileSearchRequestDTO {
   hashes: string[]
 }
@@ -567,6 +755,8 @@ export interface ProjectDTO {
   name: string
   description: string
   owner_user_id: string
+  agent_placement: AgentPlacementDTO
+  agent_pool_id: string
 }
 export interface ProjectResponseMultipleDTO {
   projects: ProjectDTO[]
@@ -577,6 +767,47 @@ export interface ProjectAddShareRequestDTO {
 export interface ProjectSharesDTO {
   user_ids: string[]
 }
+export interface AttackScheduleDTO {
+  id: string
+  name: string
+  time_created: number
+  attack_id: string
+  attack_template_id: string
+  hashlist_tag: string
+  is_distributed: boolean
+  is_enabled: boolean
+  next_run_at: number
+  repeat_interval_minutes: number
+  last_run_at: number
+  last_outcome: string
+  created_by_user_id: string
+}
+export interface AttackScheduleMultipleDTO {
+  schedules: AttackScheduleDTO[]
+}
+export interface AttackScheduleRunDTO {
+  id: string
+  attack_schedule_id: string
+  time_ran: number
+  outcome: string
+  message: string
+  attack_ids: string[]
+}
+export interface AttackScheduleRunMultipleDTO {
+  runs: AttackScheduleRunDTO[]
+}
+export interface AttackScheduleCreateRequestDTO {
+  name: string
+  attack_id: string
+  attack_template_id: string
+  hashlist_tag: string
+  is_distributed: boolean
+  start_at: number
+  repeat_interval_minutes: number
+}
+export interface AttackScheduleSetEnabledRequestDTO {
+  is_enabled: boolean
+}
 export interface UserDTO {
   id: string
   username: string
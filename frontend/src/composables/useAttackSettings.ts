@@ -48,7 +48,8 @@ export const useAttackSettings = () => {
 
     // comb?
     switch (attackSettings.attackMode) {
-      case AttackMode.Dictionary: {
+      case AttackMode.Dictionary:
+      case AttackMode.Association: {
         attackSettings.selectedWordlists = params.wordlist_filenames.slice(0, 1)
         attackSettings.selectedRulefiles = params.rules_filenames
 
@@ -91,6 +92,14 @@ export const useAttackSettings = () => {
         break
       }
 
+      case AttackMode.Association: {
+        if (attackSettings.selectedWordlists.length < 1) {
+          return 'Please select a hint wordlist'
+        }
+
+        break
+      }
+
       case AttackMode.Combinator: {
         if (attackSettings.selectedWordlists.length != 2) {
           return 'Please select two wordlists'
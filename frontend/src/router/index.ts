@@ -47,6 +47,8 @@ const router = createRouter({
 
     route('/attack-templates', 'Attack Templates', () => import('@/pages/AttackTemplates.vue')),
 
+    route('/schedules', 'Schedules', () => import('@/pages/Schedules.vue')),
+
     route('/wizard', 'Wizard', () => import('@/pages/Wizard.vue')),
 
     route('/account', 'Account', () => import('@/pages/Account.vue')),
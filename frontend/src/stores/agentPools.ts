@@ -0,0 +1,39 @@
+import { defineStore } from 'pinia'
+
+import { adminGetAgentPools } from '@/api/admin'
+import type { AgentPoolDTO } from '@/api/types'
+
+export type AgentPoolsStore = {
+  pools: AgentPoolDTO[]
+  loading: boolean
+}
+
+// Only admins can see agent pools
+export const useAgentPoolsStore = defineStore('agent-pools-store', {
+  state: () =>
+    ({
+      pools: [],
+      loading: false
+    }) as AgentPoolsStore,
+
+  actions: {
+    async load(forceRefetch = false) {
+      if (this.loading) {
+        return
+      }
+
+      if (forceRefetch || this.pools.length === 0) {
+        this.loading = true
+        try {
+          this.pools = (await adminGetAgentPools()).agent_pools
+        } finally {
+          this.loading = false
+        }
+      }
+    }
+  },
+
+  getters: {
+    byId: state => (id: string) => state.pools.find(x => x.id == id)
+  }
+})
@@ -8,6 +8,7 @@ export enum AttackMode {
   Mask = 3,
   HybridDM = 6,
   HybridMD = 7,
+  Association = 9,
   Template = 999
 }
 
@@ -23,6 +24,10 @@ export const attackModes = [
     name: 'Mask + Wordlist',
     value: AttackMode.HybridMD
   },
+  {
+    name: 'Association (per-hash hints)',
+    value: AttackMode.Association
+  },
   {
     name: 'From Template',
     value: AttackMode.Template
@@ -94,7 +99,8 @@ export function makeHashcatParams(hashType: number, attackSettings: AttackSettin
 
     additional_args: [],
     skip: 0,
-    limit: 0
+    limit: 0,
+    backend_devices: []
   }
 
   switch (attackSettings.attackMode) {
@@ -105,6 +111,13 @@ export function makeHashcatParams(hashType: number, attackSettings: AttackSettin
         rules_filenames: attackSettings.selectedRulefiles
       }
 
+    case AttackMode.Association:
+      return {
+        ...baseParams,
+        wordlist_filenames: attackSettings.selectedWordlists.slice(0, 1),
+        rules_filenames: attackSettings.selectedRulefiles
+      }
+
     case AttackMode.Combinator:
       return {
         ...baseParams,
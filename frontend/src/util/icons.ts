@@ -7,6 +7,7 @@ export const Icons = {
   Close: 'fa-solid fa-xmark',
   Start: 'fa-solid fa-play',
   Stop: 'fa-solid fa-stop',
+  Pause: 'fa-solid fa-pause',
   Autofill: 'fa-solid fa-pen-to-square',
   Clone: 'fa-solid fa-clone',
   SignOut: 'fa-solid fa-sign-out',
@@ -14,6 +15,8 @@ export const Icons = {
   Info: 'fa-solid fa-circle-info',
   Clipboard: 'fa-solid fa-clipboard',
   Retry: 'fa-solid fa-repeat',
+  MoveUp: 'fa-solid fa-arrow-up',
+  MoveDown: 'fa-solid fa-arrow-down',
 
   // objects
   Agent: 'fa-solid fa-robot',
@@ -28,6 +31,9 @@ export const Icons = {
 
   AttackTemplate: 'fa-solid fa-sliders',
   AttackTemplateSet: 'fa-solid fa-layer-group',
+  AttackPipeline: 'fa-solid fa-list-ol',
+  Schedule: 'fa-solid fa-clock',
+  Tag: 'fa-solid fa-tag',
 
   // pages
   Dashboard: 'fa-solid fa-folder',
@@ -50,5 +56,9 @@ export const Icons = {
   Locked: 'fa-solid fa-lock',
   Awaiting: 'fa-solid fa-hourglass-end',
   Dead: 'fa-solid fa-skull-crossbones',
-  Unknown: 'fa-solid fa-question'
+  Unknown: 'fa-solid fa-question',
+  Benchmark: 'fa-solid fa-gauge-high',
+  Placement: 'fa-solid fa-location-dot',
+  Drain: 'fa-solid fa-arrow-right-from-bracket',
+  Thermal: 'fa-solid fa-temperature-high'
 }